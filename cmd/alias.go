@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"awssh/config"
+	"awssh/internal/configfile"
+	"awssh/internal/logging"
+	"awssh/internal/ssh"
+)
+
+// MakeAlias used to create alias subcommand
+func MakeAlias() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "alias",
+		Short: "Manage the host aliases",
+		Long: `Manage the host aliases stored in the awssh config file (~/.awssh/config.yaml),
+an alias is a named combination of region, profile, target or tags, ssh username, port and remote command used as 'awssh <alias>'`,
+	}
+
+	command.AddCommand(makeAliasAdd(), makeAliasList(), makeAliasRemove())
+	return command
+}
+
+func makeAliasAdd() *cobra.Command {
+	var alias configfile.Alias
+
+	var command = &cobra.Command{
+		Use:   "add <name>",
+		Short: "Add or replace a host alias",
+		Example: `  awssh alias add prod-db-bastion --profile production --region ap-southeast-1 --tags "Role=bastion" --ssh-username centos --ssh-port 2222
+  awssh alias add jenkins --target i-0387e016c47c6170c
+  awssh alias add app --target app-server --remote-command "cd /opt/app" --tmux deploy`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+	}
+
+	command.Flags().StringVar(&alias.Target, "target", "", "The instance-id, Name tag value, IP or DNS name of the EC2 instance")
+	command.Flags().StringVar(&alias.Region, "region", "", "AWS region of the EC2 instance")
+	command.Flags().StringVar(&alias.Profile, "profile", "", "AWS shared config profile to be used")
+	command.Flags().StringVarP(&alias.Tags, "tags", "t", "", "A comma-separated key-value pairs of EC2 tags. Ex: 'Name=ec2,Environment=staging'")
+	command.Flags().StringVarP(&alias.SSHUsername, "ssh-username", "u", "", "EC2 SSH username")
+	command.Flags().StringVarP(&alias.SSHPort, "ssh-port", "p", "", "An EC2 instance ssh port")
+	command.Flags().StringVarP(&alias.SSHOpts, "ssh-opts", "o", "", "An additional ssh options")
+	command.Flags().BoolVar(&alias.UsePublicIP, "use-public-ip", false, "Use public IP to access the EC2 instance")
+	command.Flags().StringVar(&alias.RemoteCommand, "remote-command", "", "A command to run on the EC2 instance after login, followed by an interactive shell")
+	command.Flags().StringVar(&alias.Tmux, "tmux", "", "A tmux session on the EC2 instance to attach, created when it does not exist")
+	command.RegisterFlagCompletionFunc("target", completeInstances) // nolint: errcheck
+	command.RegisterFlagCompletionFunc("tags", completeTags)        // nolint: errcheck
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		if _, err := ssh.Options(alias.SSHOpts, nil); err != nil {
+			return err
+		}
+
+		file, err := configfile.Load(config.GetConfigFile())
+		if err != nil {
+			return err
+		}
+
+		if err := file.AddAlias(args[0], alias, reservedNames(cmd.Root())); err != nil {
+			return err
+		}
+
+		if err := file.Save(); err != nil {
+			return err
+		}
+
+		logging.Logger().Infof("awssh: alias '%s' is saved into %s", args[0], config.GetConfigFile())
+		return nil
+	}
+
+	return command
+}
+
+// reservedNames get the names and aliases of the registered awssh subcommands,
+// the hidden completion requests are added as cobra registers them only while completing
+func reservedNames(root *cobra.Command) []string {
+	names := []string{cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd}
+	for _, command := range root.Commands() {
+		names = append(names, command.Name())
+		names = append(names, command.Aliases...)
+	}
+
+	return names
+}
+
+func makeAliasList() *cobra.Command {
+	var command = &cobra.Command{
+		Use:          "list",
+		Aliases:      []string{"ls"},
+		Short:        "List the host aliases",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		file, err := configfile.Load(config.GetConfigFile())
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tTARGET\tTAGS\tREGION\tPROFILE\tUSER\tPORT")
+		for _, name := range file.AliasNames() {
+			alias, _ := file.GetAlias(name)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, orDash(alias.Target), orDash(alias.Tags), orDash(alias.Region), orDash(alias.Profile), orDash(alias.SSHUsername), orDash(alias.SSHPort))
+		}
+
+		return w.Flush()
+	}
+
+	return command
+}
+
+func makeAliasRemove() *cobra.Command {
+	var command = &cobra.Command{
+		Use:               "rm <name>",
+		Aliases:           []string{"remove"},
+		Short:             "Remove a host alias",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeAliasNames,
+		SilenceUsage:      true,
+	}
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		file, err := configfile.Load(config.GetConfigFile())
+		if err != nil {
+			return err
+		}
+
+		if err := file.RemoveAlias(args[0]); err != nil {
+			return err
+		}
+
+		if err := file.Save(); err != nil {
+			return err
+		}
+
+		logging.Logger().Infof("awssh: alias '%s' is removed", args[0])
+		return nil
+	}
+
+	return command
+}
+
+// completeAliasNames completes the first argument with the alias names
+func completeAliasNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	file, err := configfile.Load(config.GetConfigFile())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	return file.AliasNames(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// resolveAlias applies the alias settings to the flags which are not set explicitly,
+// then returns the target of the alias. The name is returned as is when it is not an alias
+func resolveAlias(flagSet *flag.FlagSet, name string) (target string, isAlias bool, err error) {
+	file, err := configfile.Load(config.GetConfigFile())
+	if err != nil {
+		return "", false, err
+	}
+
+	alias, ok := file.GetAlias(name)
+	if !ok {
+		return name, false, nil
+	}
+
+	logging.Logger().Debugf("awssh: resolved alias '%s': %+v", name, alias)
+
+	settings := map[string]string{
+		"region":       alias.Region,
+		"profile":      alias.Profile,
+		"tags":         alias.Tags,
+		"ssh-username": alias.SSHUsername,
+		"ssh-port":     alias.SSHPort,
+		"ssh-opts":     alias.SSHOpts,
+
+		"remote-command": alias.RemoteCommand,
+		"tmux":           alias.Tmux,
+	}
+	if alias.UsePublicIP {
+		settings["use-public-ip"] = "true"
+	}
+
+	if err := setDefaultFlags(flagSet, settings); err != nil {
+		return "", true, err
+	}
+
+	return alias.Target, true, nil
+}
+
+// profileDefaultEnvs are the environment variables of the flags having the profile defaults
+var profileDefaultEnvs = map[string]string{
+	"remote-command": "AWSSH_REMOTE_COMMAND",
+	"tmux":           "AWSSH_TMUX",
+}
+
+// applyProfileDefaults applies the defaults of the AWS shared config profile in use
+// to the flags which are not set explicitly, by their environment variables nor by the alias
+func applyProfileDefaults(flagSet *flag.FlagSet) error {
+	file, err := configfile.Load(config.GetConfigFile())
+	if err != nil {
+		return err
+	}
+
+	profile, ok := file.GetProfile(config.GetProfile())
+	if !ok {
+		return nil
+	}
+
+	settings := map[string]string{
+		"remote-command": profile.RemoteCommand,
+		"tmux":           profile.Tmux,
+	}
+	for flagName, env := range profileDefaultEnvs {
+		if os.Getenv(env) != "" {
+			delete(settings, flagName)
+		}
+	}
+
+	return setDefaultFlags(flagSet, settings)
+}
+
+// setDefaultFlags sets the flags which are not set yet, the empty values are ignored
+func setDefaultFlags(flagSet *flag.FlagSet, settings map[string]string) error {
+	for flagName, value := range settings {
+		if value == "" || flagSet.Changed(flagName) {
+			continue
+		}
+
+		if err := flagSet.Set(flagName, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/spf13/cobra"
+
+	"awssh/config"
+	"awssh/internal/aws"
+	"awssh/internal/cache"
+	"awssh/internal/configfile"
+	"awssh/internal/errdefs"
+	"awssh/internal/logging"
+)
+
+// completionTimeout is the timeout of refreshing the instance cache during the shell completion
+const completionTimeout = 3 * time.Second
+
+// MakeCompletion used to create completion subcommand
+func MakeCompletion() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "completion bash|zsh|fish|powershell",
+		Short: "Generate the shell completion script",
+		Long: `Generate the shell completion script, the instance-ids, Name tags, aliases and --tags are completed
+from a local instance cache (~/.awssh/cache) which is refreshed when older than AWSSH_CACHE_TTL`,
+		Example: `  # bash
+  source <(awssh completion bash)
+
+  # zsh
+  awssh completion zsh > "${fpath[1]}/_awssh"
+
+  # fish
+  awssh completion fish > ~/.config/fish/completions/awssh.fish
+
+  # powershell
+  awssh completion powershell | Out-String | Invoke-Expression`,
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		DisableFlagsInUseLine: true,
+		SilenceUsage:          true,
+	}
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		root := cmd.Root()
+
+		switch args[0] {
+		case "bash":
+			return root.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			return root.GenZshCompletion(os.Stdout)
+		case "fish":
+			return root.GenFishCompletion(os.Stdout, true)
+		case "powershell":
+			return root.GenPowerShellCompletionWithDesc(os.Stdout)
+		}
+
+		return errdefs.New(errdefs.ErrInvalidArgs, "unsupported shell '%s'", args[0])
+	}
+
+	return command
+}
+
+// completeTargets completes the target argument with the alias names, instance-ids and Name tags
+func completeTargets(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var suggestions []string
+
+	if file, err := configfile.Load(config.GetConfigFile()); err == nil {
+		for _, name := range file.AliasNames() {
+			suggestions = append(suggestions, fmt.Sprintf("%s\talias", name))
+		}
+	}
+
+	instances, directive := completeInstances(cmd, args, toComplete)
+	return filterPrefix(append(suggestions, instances...), toComplete), directive
+}
+
+// completeInstances completes the target argument with the instance-ids and Name tags
+func completeInstances(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var suggestions []string
+	names := make(map[string]bool)
+
+	for _, instance := range cachedInstances() {
+		suggestions = append(suggestions, fmt.Sprintf("%s\t%s (%s)", instance.InstanceID, instance.Name, instance.PrivateIP))
+
+		if _, ok := instance.Tags["Name"]; ok && !names[instance.Name] {
+			names[instance.Name] = true
+			suggestions = append(suggestions, fmt.Sprintf("%s\t%s", instance.Name, instance.InstanceID))
+		}
+	}
+
+	return filterPrefix(suggestions, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeTags completes the last 'Key=Value' pair of the --tags flag,
+// the tag keys are completed first followed by the values of the key
+func completeTags(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	prefix, current := "", toComplete
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix, current = toComplete[:i+1], toComplete[i+1:]
+	}
+
+	candidates := make(map[string]bool)
+	key, _, hasValue := strings.Cut(current, "=")
+
+	for _, instance := range cachedInstances() {
+		for k, v := range instance.Tags {
+			if !hasValue {
+				candidates[prefix+k+"="] = true
+			} else if k == key {
+				candidates[prefix+k+"="+v] = true
+			}
+		}
+	}
+
+	suggestions := make([]string, 0, len(candidates))
+	for candidate := range candidates {
+		suggestions = append(suggestions, candidate)
+	}
+	sort.Strings(suggestions)
+
+	return filterPrefix(suggestions, toComplete), cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeASGs completes the --asg flag with the auto-scaling group names of the instances
+func completeASGs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	members := make(map[string]int)
+	for _, instance := range cachedInstances() {
+		if instance.ASGName != "" {
+			members[instance.ASGName]++
+		}
+	}
+
+	suggestions := make([]string, 0, len(members))
+	for name, count := range members {
+		suggestions = append(suggestions, fmt.Sprintf("%s\t%d instance(s)", name, count))
+	}
+	sort.Strings(suggestions)
+
+	return filterPrefix(suggestions, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// cachedInstances get the running instances from the local instance cache,
+// the cache is refreshed from EC2 when it is stale, the stale instances are used when the refresh is failed
+func cachedInstances() []*aws.Instance {
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	awsConfig, err := aws.NewConfig(ctx, config.GetRegion(), config.GetProfile())
+	if err != nil {
+		return nil
+	}
+
+	instanceCache := cache.NewInstanceCache(config.GetCacheDir(), config.GetProfile(), awsConfig.Region, config.GetCacheTTL())
+
+	instances, fresh, err := instanceCache.Load()
+	if err != nil {
+		logging.Logger().Debugf("awssh: %v", err)
+	}
+	if fresh {
+		return instances
+	}
+
+	running, err := aws.NewProvider(ec2.NewFromConfig(awsConfig)).GetRunningInstances(ctx)
+	if err != nil {
+		logging.Logger().Debugf("awssh: unable to refresh the instance cache: %v", err)
+		return instances
+	}
+
+	if err := instanceCache.Save(running); err != nil {
+		logging.Logger().Debugf("awssh: %v", err)
+	}
+
+	return running
+}
+
+// filterPrefix keeps the suggestions starting with the prefix
+func filterPrefix(suggestions []string, prefix string) []string {
+	filtered := make([]string, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		if strings.HasPrefix(suggestion, prefix) {
+			filtered = append(filtered, suggestion)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/spf13/cobra"
+
+	"awssh/config"
+	"awssh/internal/aws"
+	"awssh/internal/ssh"
+)
+
+// MakeConsole used to create console subcommand
+func MakeConsole() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "console <target>",
+		Short: "Connect to the EC2 serial console of an instance",
+		Long: `Connect to the EC2 serial console of an instance, which is accessible even when the network or the sshd
+of the instance is broken. It requires a Nitro based instance and the serial console access enabled for the account`,
+		Example: `  awssh console i-0387e016c47c6170c
+  awssh console jenkins-master --region ap-southeast-1`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeInstances,
+		SilenceUsage:      true,
+	}
+
+	config.AddConsoleFlags(command.Flags())
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		awsConfig, err := aws.NewConfig(ctx, config.GetRegion(), config.GetProfile())
+		if err != nil {
+			return err
+		}
+
+		if err := ensureCredentials(ctx, awsConfig); err != nil {
+			return err
+		}
+
+		retryPolicy := aws.NewRetryPolicy(config.GetRetryMaxAttempts(), config.GetRetryBaseDelay(), config.GetRetryMaxDelay(), config.GetRetryErrorCodes()...)
+		noRetryConfig := aws.WithoutRetry(awsConfig)
+		ec2API := aws.NewRetryEC2Client(ec2.NewFromConfig(noRetryConfig), retryPolicy)
+		ec2InstanceConnectAPI := aws.NewRetryEC2InstanceConnectClient(ec2instanceconnect.NewFromConfig(noRetryConfig), retryPolicy)
+		ecsAPI := aws.NewRetryECSClient(ecs.NewFromConfig(noRetryConfig), retryPolicy)
+
+		if config.GetAudit() {
+			auditor, err := newAuditor(ctx, sts.NewFromConfig(awsConfig), awsConfig.Region, nil)
+			if err != nil {
+				return err
+			}
+			defer auditor.Close()
+		}
+
+		discoveryCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+		defer cancel()
+
+		// the serial console access is checked first, as it is an account setting regardless of the instance
+		if err := aws.CheckSerialConsoleAccess(discoveryCtx, ec2API); err != nil {
+			return err
+		}
+
+		provider := aws.NewProvider(ec2API, aws.NewECSTaskResolver(ecsAPI), aws.NewEKSNodeResolver())
+		instances, err := provider.GetInstanceWithTarget(discoveryCtx, args[0])
+		if err != nil {
+			return err
+		}
+
+		target, err := selectInstance(instances)
+		if err != nil {
+			return err
+		}
+
+		sshAgent, err := ssh.NewAgent()
+		if err != nil {
+			return err
+		}
+
+		return target.ConnectSerialConsole(ctx, sshAgent, ec2InstanceConnectAPI, defaultShellCommand(), awsConfig.Region)
+	}
+
+	return command
+}
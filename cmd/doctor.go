@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/spf13/cobra"
+
+	"awssh/config"
+	"awssh/internal/aws"
+	"awssh/internal/errdefs"
+)
+
+// probeTimeout is the timeout of the local TCP probe to the ssh port
+const probeTimeout = 5 * time.Second
+
+// MakeDoctor used to create doctor subcommand
+func MakeDoctor() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "doctor <target>",
+		Short: "Diagnose the ssh connectivity to an EC2 instance",
+		Long: `Diagnose the ssh connectivity to an EC2 instance by inspecting its security groups, network ACL,
+subnet route table, public IP, EC2 Instance Connect and SSM availability, then probing the ssh port`,
+		Example: `  awssh doctor i-0387e016c47c6170c
+  awssh doctor jenkins-master --use-public-ip --ssh-port 2222`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeInstances,
+		SilenceUsage:      true,
+	}
+
+	config.AddDoctorFlags(command.Flags())
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		port, err := strconv.Atoi(config.GetSSHPort())
+		if err != nil {
+			return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "invalid ssh port '%s'", config.GetSSHPort())
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		awsConfig, err := aws.NewConfig(ctx, config.GetRegion(), config.GetProfile())
+		if err != nil {
+			return err
+		}
+
+		if err := ensureCredentials(ctx, awsConfig); err != nil {
+			return err
+		}
+
+		retryPolicy := aws.NewRetryPolicy(config.GetRetryMaxAttempts(), config.GetRetryBaseDelay(), config.GetRetryMaxDelay(), config.GetRetryErrorCodes()...)
+		noRetryConfig := aws.WithoutRetry(awsConfig)
+		ec2API := aws.NewRetryEC2Client(ec2.NewFromConfig(noRetryConfig), retryPolicy)
+		ecsAPI := aws.NewRetryECSClient(ecs.NewFromConfig(noRetryConfig), retryPolicy)
+		ssmAPI := aws.NewRetrySSMClient(ssm.NewFromConfig(noRetryConfig), retryPolicy)
+
+		discoveryCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+		defer cancel()
+
+		provider := aws.NewProvider(ec2API, aws.NewECSTaskResolver(ecsAPI), aws.NewEKSNodeResolver())
+		instances, err := provider.GetInstanceWithTarget(discoveryCtx, args[0])
+		if err != nil {
+			return err
+		}
+
+		target, err := selectInstance(instances)
+		if err != nil {
+			return err
+		}
+
+		diagnoseCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+		defer cancel()
+
+		doctor := aws.NewDoctor(ec2API, ssmAPI)
+		checks, err := doctor.Diagnose(diagnoseCtx, target.InstanceID, aws.DoctorOptions{
+			Port:         port,
+			UsePublicIP:  config.GetUsePublicIP(),
+			ProbeTimeout: probeTimeout,
+		})
+		if err != nil {
+			return err
+		}
+
+		return printChecks(checks)
+	}
+
+	return command
+}
+
+// printChecks prints the checklist followed by the likely causes,
+// then fails when any of the checks is failed
+func printChecks(checks []aws.Check) error {
+	var causes []string
+
+	for _, check := range checks {
+		fmt.Fprintf(os.Stdout, "[%-4s] %-20s %s\n", strings.ToUpper(string(check.Status)), check.Name, check.Detail)
+
+		if check.Status == aws.CheckFail || check.Status == aws.CheckWarn {
+			causes = append(causes, fmt.Sprintf("%s: %s", check.Name, check.Detail))
+		}
+	}
+
+	if len(causes) == 0 {
+		fmt.Fprintln(os.Stdout, "\nNo connectivity issue is found.")
+		return nil
+	}
+
+	fmt.Fprintln(os.Stdout, "\nLikely causes:")
+	for _, cause := range causes {
+		fmt.Fprintf(os.Stdout, "  - %s\n", cause)
+	}
+
+	for _, check := range checks {
+		if check.Status == aws.CheckFail {
+			return errdefs.New(errdefs.ErrNetworkUnreachable, "the ssh connectivity check is failed")
+		}
+	}
+
+	return nil
+}
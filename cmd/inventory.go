@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/spf13/cobra"
+
+	"awssh/config"
+	"awssh/internal/aws"
+	"awssh/internal/errdefs"
+	"awssh/internal/inventory"
+	"awssh/internal/ssh"
+)
+
+// MakeInventory used to create inventory subcommand
+func MakeInventory() *cobra.Command {
+	var (
+		list  bool
+		host  string
+		proxy bool
+	)
+
+	var command = &cobra.Command{
+		Use:   "inventory",
+		Short: "Print the Ansible dynamic inventory of the running EC2 instances",
+		Long: `Print the running EC2 instances as an Ansible dynamic inventory in JSON, keyed by the instance-id and grouped by
+each tag key and value, the availability zone and the instance type, e.g. tag_Environment_staging, az_ap_southeast_1a and type_t3_micro.
+The '_meta.hostvars' has the connection host, user and port of each host along with its EC2 attributes,
+and the ssh ProxyCommand running 'awssh proxy', so Ansible connects to the hosts through EC2 Instance Connect`,
+		Example: `  awssh inventory --tags Environment=staging
+  ansible-inventory -i ./awssh-inventory.sh --graph
+  ansible-playbook -i ./awssh-inventory.sh site.yml`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+
+	config.AddInventoryFlags(command.Flags())
+	// the flags of the Ansible dynamic inventory script protocol
+	command.Flags().BoolVar(&list, "list", true, "Print the whole inventory, the default")
+	command.Flags().StringVar(&host, "host", "", "Print the variables of a host only")
+	command.Flags().BoolVar(&proxy, "proxy", true, "Connect to the hosts with 'awssh proxy' as the ssh ProxyCommand, pushing the ssh public key with EC2 Instance Connect")
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		port, err := strconv.Atoi(config.GetSSHPort())
+		if err != nil {
+			return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "invalid ssh port '%s'", config.GetSSHPort())
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		awsConfig, err := aws.NewConfig(ctx, config.GetRegion(), config.GetProfile())
+		if err != nil {
+			return err
+		}
+
+		if err := ensureCredentials(ctx, awsConfig); err != nil {
+			return err
+		}
+
+		retryPolicy := aws.NewRetryPolicy(config.GetRetryMaxAttempts(), config.GetRetryBaseDelay(), config.GetRetryMaxDelay(), config.GetRetryErrorCodes()...)
+		ec2API := aws.NewRetryEC2Client(ec2.NewFromConfig(aws.WithoutRetry(awsConfig)), retryPolicy)
+
+		discoveryCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+		defer cancel()
+
+		provider := aws.NewProvider(ec2API)
+
+		var instances []*aws.Instance
+		if config.GetInventoryTags() != "" {
+			instances, err = provider.GetInstanceWithTag(discoveryCtx, config.GetInventoryTags())
+		} else {
+			instances, err = provider.GetRunningInstances(discoveryCtx)
+		}
+		// an empty inventory is still an inventory to Ansible, unlike an error without the JSON
+		if err != nil && !errors.Is(err, errdefs.ErrNotFound) {
+			return err
+		}
+
+		opts := inventory.Options{
+			User:        config.GetSSHUsername(),
+			Port:        port,
+			UsePublicIP: config.GetUsePublicIP(),
+		}
+
+		if proxy {
+			opts.ProxyCommand, err = inventoryProxyCommand(awsConfig.Region)
+			if err != nil {
+				return err
+			}
+		}
+
+		inv := inventory.New(instances, opts)
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		if host != "" {
+			hostVars, ok := inv.Meta.HostVars[host]
+			if !ok {
+				return encoder.Encode(map[string]interface{}{})
+			}
+			return encoder.Encode(hostVars)
+		}
+
+		return encoder.Encode(inv)
+	}
+
+	return command
+}
+
+// inventoryProxyCommand creates the ssh ProxyCommand running 'awssh proxy' with the region, profile and address of the inventory,
+// pushing the ssh public key for the '%r' remote user of ssh
+func inventoryProxyCommand(region string) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to find the awssh executable")
+	}
+
+	args := []string{executable, "proxy"}
+	if region != "" {
+		args = append(args, "--region", region)
+	}
+	if config.GetProfile() != "" {
+		args = append(args, "--profile", config.GetProfile())
+	}
+	if config.GetUsePublicIP() {
+		args = append(args, "--use-public-ip")
+	}
+	args = append(args, "--ssh-username", "%r")
+
+	return ssh.JoinArgs(args), nil
+}
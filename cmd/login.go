@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"syscall"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"awssh/config"
+	"awssh/internal/aws"
+	"awssh/internal/errdefs"
+	"awssh/internal/logging"
+)
+
+// MakeLogin used to create login subcommand
+func MakeLogin() *cobra.Command {
+	var noBrowser bool
+
+	var command = &cobra.Command{
+		Use:   "login",
+		Short: "Login to AWS IAM Identity Center (SSO)",
+		Long: `Login to AWS IAM Identity Center (SSO) with the device authorization flow,
+the token is cached in the standard SSO cache (~/.aws/sso/cache) shared with the AWS CLI`,
+		Example: `  awssh login
+  awssh login --profile production --no-browser`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+
+	config.AddAWSFlags(command.Flags())
+	command.Flags().BoolVar(&noBrowser, "no-browser", false, "Do not open the verification URL in the default browser")
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		awsConfig, err := aws.NewConfig(ctx, config.GetRegion(), config.GetProfile())
+		if err != nil {
+			return err
+		}
+
+		profile, err := aws.LoadSSOProfile(ctx, config.GetProfile())
+		if err != nil {
+			return err
+		}
+
+		return ssoLogin(ctx, awsConfig, profile, !noBrowser)
+	}
+
+	return command
+}
+
+// ensureCredentials runs the SSO login when the SSO token of an SSO profile is missing, expired or invalid,
+// and the session is interactive, so the user does not need to run 'awssh login' beforehand
+func ensureCredentials(ctx context.Context, awsConfig awssdk.Config) error {
+	if awsConfig.Credentials == nil {
+		return nil
+	}
+
+	retrieveCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+	defer cancel()
+
+	_, err := awsConfig.Credentials.Retrieve(retrieveCtx)
+	if err == nil {
+		return nil
+	}
+
+	profile, profileErr := aws.LoadSSOProfile(ctx, config.GetProfile())
+	if profileErr != nil {
+		// not an SSO profile, the credentials error is reported by the AWS API calls
+		return nil
+	}
+
+	if !aws.IsSSOTokenError(err) {
+		// e.g. the network errors, a login does not fix them
+		return aws.WrapCredentialsError(err, profile.Profile)
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errdefs.Wrap(errdefs.ErrAuthDenied, err, "SSO session of AWS profile '%s' is expired, run 'awssh login' to login", profile.Profile)
+	}
+
+	logging.Logger().Warnf("awssh: SSO session of AWS profile '%s' is expired, logging in", profile.Profile)
+	return ssoLogin(ctx, awsConfig, profile, true)
+}
+
+func ssoLogin(ctx context.Context, awsConfig awssdk.Config, profile *aws.SSOProfile, openBrowser bool) error {
+	login := aws.NewSSOLogin(aws.NewSSOOIDCClient(awsConfig, profile), func(auth aws.SSODeviceAuthorization) {
+		url := auth.VerificationURIComplete
+		if url == "" {
+			url = auth.VerificationURI
+		}
+
+		fmt.Fprintf(os.Stderr, "To login to AWS IAM Identity Center, open the following URL in a browser:\n\n  %s\n\nand confirm the code: %s\n\n", url, auth.UserCode)
+
+		if openBrowser {
+			if err := browserCommand(url).Start(); err != nil {
+				logging.Logger().Debugf("awssh: unable to open the browser: %v", err)
+			}
+		}
+	})
+
+	token, err := login.Login(ctx, profile)
+	if err != nil {
+		return err
+	}
+
+	logging.Logger().Infof("awssh: successfully logged in to %s, the session expires at %s", profile.StartURL, token.ExpiresAt)
+	return nil
+}
+
+func browserCommand(url string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url)
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		return exec.Command("xdg-open", url)
+	}
+}
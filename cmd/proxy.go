@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/spf13/cobra"
+
+	"awssh/config"
+	"awssh/internal/aws"
+	"awssh/internal/errdefs"
+	"awssh/internal/logging"
+	"awssh/internal/ssh"
+)
+
+// MakeProxy used to create proxy subcommand
+func MakeProxy() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "proxy <instance-id|ip> <port>",
+		Short: "Proxy an ssh connection to an EC2 instance, as the ssh ProxyCommand",
+		Long: `Push the ssh public key with EC2 Instance Connect to the EC2 instance, then connect the standard input and output to its ssh port.
+It is meant to be the ssh ProxyCommand, so ssh and the tools running it, e.g. Ansible with 'awssh inventory', connect through EC2 Instance Connect.
+The ssh public key is the first key of the ssh-agent, or a temporary ssh keypair added to the agent until the connection is closed`,
+		Example: `  ssh -o ProxyCommand="awssh proxy --ssh-username %r %h %p" ec2-user@10.0.1.10
+  ssh -o ProxyCommand="awssh proxy --ssh-username %r i-0387e016c47c6170c %p" ec2-user@i-0387e016c47c6170c`,
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+	}
+
+	config.AddProxyFlags(command.Flags())
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		targetArg, port := args[0], args[1]
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		awsConfig, err := aws.NewConfig(ctx, config.GetRegion(), config.GetProfile())
+		if err != nil {
+			return err
+		}
+
+		if err := ensureCredentials(ctx, awsConfig); err != nil {
+			return err
+		}
+
+		retryPolicy := aws.NewRetryPolicy(config.GetRetryMaxAttempts(), config.GetRetryBaseDelay(), config.GetRetryMaxDelay(), config.GetRetryErrorCodes()...)
+		noRetryConfig := aws.WithoutRetry(awsConfig)
+		ec2API := aws.NewRetryEC2Client(ec2.NewFromConfig(noRetryConfig), retryPolicy)
+		ec2InstanceConnectAPI := aws.NewRetryEC2InstanceConnectClient(ec2instanceconnect.NewFromConfig(noRetryConfig), retryPolicy)
+
+		if config.GetAudit() {
+			auditor, err := newAuditor(ctx, sts.NewFromConfig(awsConfig), awsConfig.Region, nil)
+			if err != nil {
+				return err
+			}
+			defer auditor.Close()
+		}
+
+		discoveryCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+		defer cancel()
+
+		instances, err := aws.NewProvider(ec2API).GetInstanceWithTarget(discoveryCtx, targetArg)
+		if err != nil {
+			return err
+		}
+		// the proxy has no terminal to select the instance with
+		if len(instances) > 1 {
+			return errdefs.New(errdefs.ErrInvalidArgs, "'%s' matches %d EC2 instances, use the instance-id instead", targetArg, len(instances))
+		}
+		target := instances[0]
+
+		sshAgent, err := ssh.NewAgent()
+		if err != nil {
+			return err
+		}
+
+		sshSession, err := ssh.NewSession(sshAgent, target.InstanceID)
+		if err != nil {
+			return err
+		}
+		// the temporary ssh keypair lives as long as the proxied connection
+		defer sshSession.Close() // nolint: errcheck
+
+		address, err := target.PushSSHPublicKey(ctx, ec2InstanceConnectAPI, sshSession, config.GetSSHUsername(), config.GetUsePublicIP())
+		if err != nil {
+			return err
+		}
+		// the address given by ssh is connected to as is, it is either of the instance addresses
+		if net.ParseIP(targetArg) != nil {
+			address = targetArg
+		}
+
+		connectCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+		defer cancel()
+
+		logging.Logger().Debugf("awssh: proxy the ssh connection to the EC2 instance target '%s' (%s) at %s", target.Name, target.InstanceID, net.JoinHostPort(address, port))
+
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(connectCtx, "tcp", net.JoinHostPort(address, port))
+		if err != nil {
+			return errdefs.Wrap(errdefs.ErrNetworkUnreachable, err, "unable to connect to EC2 instance '%s' (%s) at %s", target.Name, target.InstanceID, net.JoinHostPort(address, port))
+		}
+		defer conn.Close()
+
+		return proxyStdio(ctx, conn)
+	}
+
+	return command
+}
+
+// proxyStdio copies the standard input to the connection and the connection to the standard output,
+// until the connection is closed by the instance or the context is cancelled
+func proxyStdio(ctx context.Context, conn net.Conn) error {
+	go func() {
+		io.Copy(conn, os.Stdin) // nolint: errcheck
+		// the end of the input is passed along, the instance closes the connection afterwards
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.CloseWrite() // nolint: errcheck
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(os.Stdout, conn)
+		done <- err
+	}()
+
+	select {
+	case <-ctx.Done():
+		return errdefs.Wrap(errdefs.ErrCancelled, ctx.Err(), "the proxied connection is interrupted")
+	case err := <-done:
+		if err != nil {
+			return errdefs.Wrap(errdefs.ErrNetworkUnreachable, err, "the proxied connection is broken")
+		}
+		return nil
+	}
+}
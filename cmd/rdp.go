@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"awssh/config"
+	"awssh/internal/aws"
+	"awssh/internal/errdefs"
+	"awssh/internal/logging"
+	"awssh/internal/rdp"
+)
+
+// The port forward modes to reach the RDP port of a private instance
+const (
+	forwardSSM     = "ssm"
+	forwardBastion = "bastion"
+)
+
+// MakeRDP used to create rdp subcommand
+func MakeRDP() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "rdp <target>",
+		Short: "Access a Windows EC2 instance with RDP",
+		Long: `Retrieve the administrator password of a Windows EC2 instance, decrypted with the private key of its key pair,
+and write an .rdp file pointing at the instance. A private instance is reached through a local port forward with SSM or an ssh bastion`,
+		Example: `  awssh rdp windows-jumphost --use-public-ip
+  awssh rdp i-0387e016c47c6170c --key-file ~/.ssh/windows-prod.pem --forward ssm
+  awssh rdp i-0387e016c47c6170c --bastion prod-bastion --local-port 13389`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeInstances,
+		SilenceUsage:      true,
+	}
+
+	config.AddRDPFlags(command.Flags())
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		forward := config.GetRDPForward()
+		if forward == "" && config.GetRDPBastion() != "" {
+			forward = forwardBastion
+		}
+
+		switch {
+		case forward != "" && forward != forwardSSM && forward != forwardBastion:
+			return errdefs.New(errdefs.ErrInvalidArgs, "invalid forward '%s', either %s or %s", forward, forwardSSM, forwardBastion)
+		case forward == forwardBastion && config.GetRDPBastion() == "":
+			return errdefs.New(errdefs.ErrInvalidArgs, "the bastion forward requires a --bastion target")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		awsConfig, err := aws.NewConfig(ctx, config.GetRegion(), config.GetProfile())
+		if err != nil {
+			return err
+		}
+
+		if err := ensureCredentials(ctx, awsConfig); err != nil {
+			return err
+		}
+
+		retryPolicy := aws.NewRetryPolicy(config.GetRetryMaxAttempts(), config.GetRetryBaseDelay(), config.GetRetryMaxDelay(), config.GetRetryErrorCodes()...)
+		noRetryConfig := aws.WithoutRetry(awsConfig)
+		ec2API := aws.NewRetryEC2Client(ec2.NewFromConfig(noRetryConfig), retryPolicy)
+		ecsAPI := aws.NewRetryECSClient(ecs.NewFromConfig(noRetryConfig), retryPolicy)
+
+		provider := aws.NewProvider(ec2API, aws.NewECSTaskResolver(ecsAPI), aws.NewEKSNodeResolver())
+
+		discoveryCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+		defer cancel()
+
+		instances, err := provider.GetInstanceWithTarget(discoveryCtx, args[0])
+		if err != nil {
+			return err
+		}
+
+		target, err := selectInstance(instances)
+		if err != nil {
+			return err
+		}
+
+		if !target.IsWindows() {
+			logging.Logger().Warnf("awssh: EC2 instance '%s' (%s) is not a Windows instance", target.Name, target.InstanceID)
+		}
+
+		password, err := windowsPassword(ctx, provider, target)
+		if err != nil {
+			return err
+		}
+
+		file := rdp.File{
+			Address:  target.PrivateIP,
+			Port:     rdp.DefaultPort,
+			Username: config.GetRDPUsername(),
+		}
+
+		switch {
+		case forward != "":
+			file.Address = "localhost"
+			file.Port = config.GetRDPLocalPort()
+		case config.GetUsePublicIP():
+			if target.PublicIP == "" {
+				return errdefs.New(errdefs.ErrNotFound, "could not find public IP for EC2 instance target '%s' (%s)", target.Name, target.InstanceID)
+			}
+			file.Address = target.PublicIP
+		case target.PrivateIP == "":
+			return errdefs.New(errdefs.ErrNotFound, "could not find private IP for EC2 instance target '%s' (%s)", target.Name, target.InstanceID)
+		}
+
+		rdpFile := config.GetRDPFile()
+		if rdpFile == "" {
+			rdpFile = filepath.Join(config.GetRDPDir(), target.InstanceID+".rdp")
+		}
+
+		if err := file.Write(rdpFile); err != nil {
+			return err
+		}
+
+		fmt.Printf("Instance: %s (%s)\n", target.Name, target.InstanceID)
+		fmt.Printf("Address:  %s:%d\n", file.Address, file.Port)
+		fmt.Printf("Username: %s\n", file.Username)
+		fmt.Printf("Password: %s\n", password)
+		fmt.Printf("RDP file: %s\n", rdpFile)
+
+		if forward == "" {
+			return nil
+		}
+
+		forwardCmd, err := rdpForwardCommand(ctx, cmd.Flags(), forward, target)
+		if err != nil {
+			return err
+		}
+
+		logging.Logger().Infof("awssh: forwarding localhost:%d to the RDP port of EC2 instance '%s' (%s) with %s, press Ctrl+C to stop",
+			config.GetRDPLocalPort(), target.Name, target.InstanceID, forward)
+
+		err = forwardCmd.Run()
+		if ctx.Err() != nil {
+			// the forward is meant to be stopped with Ctrl+C
+			return nil
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return &errdefs.ExitError{Code: exitErr.ExitCode()}
+		}
+		if err != nil {
+			return errdefs.Wrap(errdefs.ErrSSHFailure, err, "unable to run the %s port forward", forward)
+		}
+
+		return nil
+	}
+
+	return command
+}
+
+// windowsPassword get the administrator password of the Windows instance,
+// decrypted with the private key of the key pair the instance is launched with
+func windowsPassword(ctx context.Context, provider *aws.Provider, target *aws.Instance) (string, error) {
+	keyFile := config.GetRDPKeyFile()
+	if keyFile == "" {
+		if target.KeyName == "" {
+			return "", errdefs.New(errdefs.ErrInvalidArgs, "EC2 instance '%s' (%s) is launched without a key pair, its password can not be decrypted", target.Name, target.InstanceID)
+		}
+
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to find the private key, set it with --key-file")
+		}
+		keyFile = filepath.Join(home, ".ssh", target.KeyName+".pem")
+	}
+
+	privateKey, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to read private key of key pair '%s'", target.KeyName)
+	}
+
+	passwordCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+	defer cancel()
+
+	passwordData, err := provider.GetPasswordData(passwordCtx, target)
+	if err != nil {
+		return "", err
+	}
+
+	return rdp.DecryptPassword(passwordData, privateKey)
+}
+
+// rdpForwardCommand creates the command forwarding the local port to the RDP port of the instance,
+// either with an SSM port forwarding session or an ssh tunnel through the bastion with awssh itself
+func rdpForwardCommand(ctx context.Context, flagSet *flag.FlagSet, forward string, target *aws.Instance) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+
+	switch forward {
+	case forwardSSM:
+		args := []string{
+			"ssm", "start-session",
+			"--target", target.InstanceID,
+			"--document-name", "AWS-StartPortForwardingSession",
+			"--parameters", fmt.Sprintf("portNumber=%d,localPortNumber=%d", rdp.DefaultPort, config.GetRDPLocalPort()),
+		}
+		if config.GetRegion() != "" {
+			args = append(args, "--region", config.GetRegion())
+		}
+		if config.GetProfile() != "" {
+			args = append(args, "--profile", config.GetProfile())
+		}
+
+		cmd = exec.CommandContext(ctx, "aws", args...)
+	case forwardBastion:
+		if target.PrivateIP == "" {
+			return nil, errdefs.New(errdefs.ErrNotFound, "could not find private IP for EC2 instance target '%s' (%s)", target.Name, target.InstanceID)
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			return nil, errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to find the awssh executable")
+		}
+
+		args := []string{
+			config.GetRDPBastion(),
+			"--ssh-opts", fmt.Sprintf("-o ConnectTimeout=5 -o ExitOnForwardFailure=yes -N -L %d:%s:%d", config.GetRDPLocalPort(), target.PrivateIP, rdp.DefaultPort),
+			"--remote-command=",
+			"--tmux=",
+		}
+		// the region and profile given explicitly are passed along, otherwise they are left to the bastion alias
+		for _, flagName := range []string{"region", "profile"} {
+			if flagSet.Changed(flagName) {
+				args = append(args, "--"+flagName, flagSet.Lookup(flagName).Value.String())
+			}
+		}
+
+		cmd = exec.CommandContext(ctx, executable, args...)
+	default:
+		return nil, errdefs.New(errdefs.ErrInvalidArgs, "invalid forward '%s', either %s or %s", forward, forwardSSM, forwardBastion)
+	}
+
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	return cmd, nil
+}
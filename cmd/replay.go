@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"awssh/internal/record"
+)
+
+// MakeReplay used to create replay subcommand
+func MakeReplay() *cobra.Command {
+	var (
+		speed         float64
+		idleTimeLimit float64
+	)
+
+	var command = &cobra.Command{
+		Use:   "replay <file>",
+		Short: "Replay a recorded ssh session",
+		Long:  "Replay an ssh session recorded in asciicast v2 format with the --record flag",
+		Example: `  awssh replay session.cast
+  awssh replay session.cast --speed 2 --idle-time-limit 1`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+	}
+
+	command.Flags().Float64VarP(&speed, "speed", "s", 1, "Playback speed multiplier")
+	command.Flags().Float64VarP(&idleTimeLimit, "idle-time-limit", "i", 0, "Limit the idle time between events to the given seconds")
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("awssh: unable to open record file: (%v)", err)
+		}
+		defer f.Close()
+
+		player := record.NewPlayer(speed, time.Duration(idleTimeLimit*float64(time.Second)))
+		_, err = player.Play(f, os.Stdout)
+		return err
+	}
+
+	return command
+}
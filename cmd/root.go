@@ -1,27 +1,38 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"os/exec"
-	"regexp"
+	"os/signal"
 	"strings"
+	"syscall"
 
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 
 	"awssh/config"
+	"awssh/internal/audit"
 	"awssh/internal/aws"
+	"awssh/internal/errdefs"
 	"awssh/internal/logging"
+	"awssh/internal/record"
 	"awssh/internal/ssh"
 )
 
 // MakeRoot used to create a root command functionality
 func MakeRoot() *cobra.Command {
 	var cmd = &cobra.Command{
-		Use:   "awssh",
+		Use:   "awssh [target]",
 		Short: "awssh is a simple CLI to ssh'ing EC2",
 		Long:  "awssh is a simple CLI providing an ssh access to EC2 utilizing ec2-instance-connect",
 		Example: `
@@ -31,58 +42,184 @@ func MakeRoot() *cobra.Command {
 	  # Select EC2 instance with instance-id
 	  awssh i-0387e016c47c6170c
 
+	  # Select EC2 instance with Name tag, private or public IP, or private DNS name
+	  awssh jenkins-master
+	  awssh 10.10.5.100
+	  awssh ip-10-10-5-100.ap-southeast-1.compute.internal
+
 	  # Select EC2 instance given with selected tags
 	  awssh --tags "Environment=production,Project=jenkins,Owner=SRE"
 
+	  # Select the EC2 instance running an ECS task, or an EKS node with its providerID
+	  awssh arn:aws:ecs:ap-southeast-1:123456789012:task/production/0a1b2c3d4e5f67890a1b2c3d4e5f6789
+	  awssh ecs:production/0a1b2c3d4e5f67890a1b2c3d4e5f6789
+	  awssh aws:///ap-southeast-1a/i-0387e016c47c6170c
+
+	  # Select a random in-service EC2 instance of an auto-scaling group
+	  awssh --asg web-prod
+
+	  # Connect with a host alias, see 'awssh alias --help'
+	  awssh prod-db-bastion
+
 	  # Use an additional ssh options
 	  awssh --tags "Environment=staging,ProductDomain=bastion" --ssh-username=centos --ssh-port=2222 --ssh-opts="-o ServerAliveInterval=60s"
+	  awssh i-0387e016c47c6170c --ssh-opts='-o "ProxyCommand=nc %h %p"' --ssh-opt ServerAliveInterval=60 --ssh-opt ServerAliveCountMax=3
+
+	  # Land in a root shell, or attach to a tmux session created when it does not exist
+	  awssh i-0387e016c47c6170c --remote-command "sudo -i"
+	  awssh i-0387e016c47c6170c --tmux main
 
 	  # Use public ip to connect to the EC2 instance
 	  awssh --use-public-ip
+
+	  # Check the required IAM permissions before connecting
+	  awssh i-0387e016c47c6170c --preflight
+
+	  # Record the ssh session into an asciicast file
+	  awssh i-0387e016c47c6170c --record session.cast
+
+	  # Multiplex the connections through an ssh ControlMaster, see 'awssh sessions --help'
+	  awssh i-0387e016c47c6170c --multiplex --control-persist 30m
 	`,
 	}
 
 	cmd.Args = cobra.MaximumNArgs(1)
+	cmd.ValidArgsFunction = completeTargets
+	cmd.SetFlagErrorFunc(func(c *cobra.Command, err error) error {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "invalid flag")
+	})
+	cmd.PersistentPreRun = initLogger
 	cmd.Run = runSSHAccess
 
+	config.AddLoggingFlags(cmd.PersistentFlags())
+	config.AddConfigFileFlags(cmd.PersistentFlags())
 	config.AddEC2AccessFlags(cmd.Flags())
+	cmd.RegisterFlagCompletionFunc("tags", completeTags) // nolint: errcheck
+	cmd.RegisterFlagCompletionFunc("asg", completeASGs)  // nolint: errcheck
 	return cmd
 }
 
-func validateInstanceIDArgs(args []string) (err error) {
-	if len(args) > 0 {
-		match, _ := regexp.MatchString(`^i-[\w]+`, args[0])
-		if !match {
-			return fmt.Errorf("Invalid instance-id format: '%s'", args[0])
-		}
+func initLogger(cmd *cobra.Command, args []string) {
+	_, err := logging.NewLogger(logging.Options{
+		Format: config.GetLogFormat(),
+		Level:  config.GetLogLevel(),
+		File:   config.GetLogFile(),
+		Debug:  config.GetDebugMode(),
+	})
+	if err != nil {
+		logging.ExitWithError(err)
 	}
-	return
 }
 
 func runSSHAccess(cmd *cobra.Command, args []string) {
-	logging.NewLogger(config.GetDebugMode())
+	var (
+		target     *aws.Instance
+		targetName string
+		isAlias    bool
+	)
 
-	if err := validateInstanceIDArgs(args); err != nil {
+	// the alias is resolved first, since it may select the region and profile
+	if len(args) > 0 {
+		var err error
+		targetName, isAlias, err = resolveAlias(cmd.Flags(), args[0])
+		if err != nil {
+			logging.ExitWithError(err)
+		}
+	}
+
+	if err := applyProfileDefaults(cmd.Flags()); err != nil {
 		logging.ExitWithError(err)
 	}
 
-	var target *aws.Instance
+	// the malformed ssh options are reported before any of the AWS API calls
+	if _, err := ssh.Options(config.GetSSHOpts(), config.GetSSHOpt()); err != nil {
+		logging.ExitWithError(err)
+	}
 
-	session := aws.NewSession(config.GetRegion())
-	ec2API := ec2.New(session)
-	ec2InstanceConnectAPI := ec2instanceconnect.New(session)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	ec2Provider := aws.NewProvider(ec2API)
+	awsConfig, err := aws.NewConfig(ctx, config.GetRegion(), config.GetProfile())
+	if err != nil {
+		logging.ExitWithError(err)
+	}
 
-	if len(args) > 0 {
-		instances, err := ec2Provider.GetInstanceWithID(args[0])
+	if err := ensureCredentials(ctx, awsConfig); err != nil {
+		logging.ExitWithError(err)
+	}
+
+	// the retries are handled by the awssh retry policy instead of the SDK
+	retryPolicy := aws.NewRetryPolicy(config.GetRetryMaxAttempts(), config.GetRetryBaseDelay(), config.GetRetryMaxDelay(), config.GetRetryErrorCodes()...)
+	noRetryConfig := aws.WithoutRetry(awsConfig)
+	ec2API := aws.NewRetryEC2Client(ec2.NewFromConfig(noRetryConfig), retryPolicy)
+	ec2InstanceConnectAPI := aws.NewRetryEC2InstanceConnectClient(ec2instanceconnect.NewFromConfig(noRetryConfig), retryPolicy)
+
+	ecsAPI := aws.NewRetryECSClient(ecs.NewFromConfig(noRetryConfig), retryPolicy)
+
+	ec2Provider := aws.NewProvider(ec2API, aws.NewECSTaskResolver(ecsAPI), aws.NewEKSNodeResolver())
+
+	var preflight *aws.Preflight
+	if config.GetPreflight() {
+		preflight, err = newPreflight(ctx, awsConfig)
+		if err != nil {
+			logging.ExitWithError(err)
+		}
+	}
+
+	if config.GetAudit() {
+		// the caller identity fetched by the preflight check is reused, saving a call to STS
+		var identity *aws.Identity
+		if preflight != nil {
+			identity = preflight.Identity
+		}
+
+		auditor, err := newAuditor(ctx, sts.NewFromConfig(awsConfig), awsConfig.Region, identity)
+		if err != nil {
+			logging.ExitWithError(err)
+		}
+		defer auditor.Close()
+	}
+
+	discoveryCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+	defer cancel()
+
+	switch {
+	case config.GetASG() != "" && targetName != "":
+		logging.ExitWithError(errdefs.New(errdefs.ErrInvalidArgs, "either a target or --asg is allowed, not both"))
+	case config.GetASG() != "":
+		asgAPI := aws.NewRetryAutoScalingClient(autoscaling.NewFromConfig(noRetryConfig), retryPolicy)
+
+		instances, err := ec2Provider.GetInstanceWithASG(discoveryCtx, asgAPI, config.GetASG())
+		if err != nil {
+			logging.ExitWithError(err)
+		}
+
+		// any in-service instance of the group will do, the load is spread by picking randomly
+		target = instances[rand.Intn(len(instances))]
+		logging.Logger().Infof("awssh: selected EC2 instance '%s' (%s) of auto-scaling group '%s'", target.Name, target.InstanceID, config.GetASG())
+	case targetName != "":
+		instances, err := ec2Provider.GetInstanceWithTarget(discoveryCtx, targetName)
+		if err != nil {
+			logging.ExitWithError(err)
+		}
+
+		target, err = selectInstance(instances)
+		if err != nil {
+			logging.ExitWithError(err)
+		}
+	case isAlias:
+		// an alias without target selects the instances with its tags
+		instances, err := ec2Provider.GetInstanceWithTag(discoveryCtx, config.GetEC2Tags())
 		if err != nil {
 			logging.ExitWithError(err)
 		}
 
-		target = instances[0]
-	} else {
-		instances, err := ec2Provider.GetInstanceWithTag(config.GetEC2Tags())
+		target, err = selectInstance(instances)
+		if err != nil {
+			logging.ExitWithError(err)
+		}
+	default:
+		instances, err := ec2Provider.GetInstanceWithTag(discoveryCtx, config.GetEC2Tags())
 		if err != nil {
 			logging.ExitWithError(err)
 		}
@@ -93,28 +230,112 @@ func runSSHAccess(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if target.IsWindows() {
+		logging.ExitWithError(errdefs.New(errdefs.ErrInvalidArgs, "EC2 instance '%s' (%s) is a Windows instance, use 'awssh rdp %s' instead", target.Name, target.InstanceID, target.InstanceID))
+	}
+
+	if preflight != nil {
+		permission := preflight.SendSSHPublicKeyPermission(awsConfig.Region, target.InstanceID, config.GetSSHUsername())
+		if err := checkPermissions(ctx, preflight, permission); err != nil {
+			logging.ExitWithError(err)
+		}
+	}
+
+	if config.GetStrictHostKeyChecking() {
+		hostKeyCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+		defer cancel()
+
+		hostKeys, err := ec2Provider.GetHostKeys(hostKeyCtx, target)
+		if err != nil {
+			logging.Logger().Warnf("awssh: unable to get host keys of EC2 instance '%s' (%s): %v", target.Name, target.InstanceID, err)
+		}
+		target.HostKeys = hostKeys
+	}
+
 	sshAgent, err := ssh.NewAgent()
 	if err != nil {
 		logging.ExitWithError(err)
 	}
 
-	if err := target.Connect(sshAgent, ec2InstanceConnectAPI, defaultShellCommand(), config.GetUsePublicIP()); err != nil {
+	shellCommand := defaultShellCommand()
+
+	var recorder *record.Recorder
+	if config.GetRecordFile() != "" {
+		recordFile, err := os.OpenFile(config.GetRecordFile(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			logging.ExitWithError(fmt.Errorf("awssh: unable to create record file: (%v)", err))
+		}
+		defer recordFile.Close()
+
+		recorder, err = newSessionRecorder(recordFile, target, awsConfig.Region)
+		if err != nil {
+			logging.ExitWithError(err)
+		}
+
+		logging.Logger().Infof("awssh: recording the ssh session into %s", recordFile.Name())
+		shellCommand = recordShellCommand(recorder)
+	}
+
+	err = target.Connect(ctx, sshAgent, ec2InstanceConnectAPI, shellCommand, config.GetUsePublicIP())
+	if recorder != nil {
+		// the end of the output held by the recorder is recorded before exiting
+		if closeErr := recorder.Close(); closeErr != nil {
+			logging.Logger().Warnf("awssh: unable to record the end of the ssh session: %v", closeErr)
+		}
+	}
+	if err != nil {
 		logging.ExitWithError(err)
 	}
 }
 
+// newAuditor initialize the application auditor with the AWS identity used by the session,
+// the identity is fetched from STS when it is not given
+func newAuditor(ctx context.Context, stsAPI aws.STSAPI, region string, identity *aws.Identity) (*audit.Auditor, error) {
+	if identity == nil {
+		ctx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+		defer cancel()
+
+		var err error
+		identity, err = aws.GetCallerIdentity(ctx, stsAPI)
+		if err != nil {
+			logging.Logger().Warnf("awssh: unable to get the AWS caller identity for the audit log: %v", err)
+			identity = &aws.Identity{}
+		}
+	}
+
+	return audit.NewAuditor(audit.Options{
+		File:      config.GetAuditLogFile(),
+		Syslog:    config.GetAuditSyslog(),
+		CallerARN: identity.ARN,
+		Region:    region,
+	})
+}
+
+// selectInstance get the instance directly when there is exactly one, otherwise the user picks one
+func selectInstance(instances []*aws.Instance) (*aws.Instance, error) {
+	if len(instances) == 1 {
+		return instances[0], nil
+	}
+
+	return promptUI(instances)
+}
+
 func promptUI(instances []*aws.Instance) (instance *aws.Instance, err error) {
+	// the instances of an auto-scaling group are listed together
+	aws.SortByASG(instances)
+
 	searcher := func(i string, index int) bool {
 		inst := instances[index]
 		name := inst.Name
 		input := i
-		return strings.Contains(name, input) || strings.Contains(inst.InstanceID, input) || strings.Contains(inst.PrivateIP, input) || strings.Contains(inst.PublicIP, input)
+		return strings.Contains(name, input) || strings.Contains(inst.InstanceID, input) || strings.Contains(inst.PrivateIP, input) || strings.Contains(inst.PublicIP, input) ||
+			strings.Contains(inst.ASGName, input) || strings.Contains(inst.Cluster(), input)
 	}
 
 	templates := &promptui.SelectTemplates{
 		Label:    `{{ . }}`,
-		Active:   `{{ "»" | magenta }} {{ .Name | yellow }} {{ .InstanceID | green }} ({{ .PrivateIP | red }}{{if ne .PublicIP "" }} {{"/"}} {{ .PublicIP | red }}{{ end }})`,
-		Inactive: `  {{ .Name }} {{ .InstanceID | cyan }} ({{ .PrivateIP }}{{if ne .PublicIP "" }} {{"/"}} {{ .PublicIP }}{{ end }})`,
+		Active:   `{{ "»" | magenta }} {{ .Name | yellow }} {{ .InstanceID | green }} ({{ .PrivateIP | red }}{{if ne .PublicIP "" }} {{"/"}} {{ .PublicIP | red }}{{ end }}){{ if .ASGName }} {{ printf "[%s]" .ASGName | blue }}{{ end }}{{ if .Cluster }} {{ .Cluster | faint }}{{ end }}`,
+		Inactive: `  {{ .Name }} {{ .InstanceID | cyan }} ({{ .PrivateIP }}{{if ne .PublicIP "" }} {{"/"}} {{ .PublicIP }}{{ end }}){{ if .ASGName }} {{ printf "[%s]" .ASGName | blue }}{{ end }}{{ if .Cluster }} {{ .Cluster | faint }}{{ end }}`,
 		Selected: `{{ .Name | green }} {{ .InstanceID | red }}`,
 	}
 
@@ -124,10 +345,14 @@ func promptUI(instances []*aws.Instance) (instance *aws.Instance, err error) {
 		Templates: templates,
 		Size:      10,
 		Searcher:  searcher,
+		Stdout:    os.Stderr,
 	}
 
 	i, _, err := prompt.Run()
 
+	if err == promptui.ErrInterrupt || err == promptui.ErrEOF {
+		return nil, errdefs.Wrap(errdefs.ErrCancelled, err, "instance selection is cancelled")
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -136,8 +361,8 @@ func promptUI(instances []*aws.Instance) (instance *aws.Instance, err error) {
 }
 
 func defaultShellCommand() aws.ShellCommandFunc {
-	return func(name string, args ...string) *exec.Cmd {
-		cmd := exec.Command(name, args...)
+	return func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, name, args...)
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -145,3 +370,39 @@ func defaultShellCommand() aws.ShellCommandFunc {
 		return cmd
 	}
 }
+
+// recordShellCommand is like defaultShellCommand, but the terminal output is also recorded.
+// The stdin is kept as the terminal itself, so ssh still allocates a tty and handles the window size
+func recordShellCommand(recorder *record.Recorder) aws.ShellCommandFunc {
+	return func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = io.MultiWriter(os.Stdout, recorder.Stream())
+		cmd.Stderr = io.MultiWriter(os.Stderr, recorder.Stream())
+
+		return cmd
+	}
+}
+
+func newSessionRecorder(w io.Writer, target *aws.Instance, region string) (*record.Recorder, error) {
+	width, height, err := term.GetSize(int(os.Stdin.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+
+	return record.NewRecorder(w, record.Header{
+		Width:  width,
+		Height: height,
+		Title:  fmt.Sprintf("%s@%s (%s)", config.GetSSHUsername(), target.Name, target.InstanceID),
+		Env: map[string]string{
+			"SHELL": os.Getenv("SHELL"),
+			"TERM":  os.Getenv("TERM"),
+		},
+		Session: &record.SessionInfo{
+			InstanceID:   target.InstanceID,
+			InstanceName: target.Name,
+			User:         config.GetSSHUsername(),
+			Region:       region,
+		},
+	})
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"awssh/config"
+	"awssh/internal/errdefs"
+	"awssh/internal/logging"
+	"awssh/internal/ssh"
+)
+
+// MakeSessions used to create sessions subcommand
+func MakeSessions() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "sessions",
+		Short: "Manage the multiplexed ssh sessions",
+		Long: `Manage the ssh ControlMaster sockets started by 'awssh --multiplex' in the awssh runtime directory
+($XDG_RUNTIME_DIR/awssh or ~/.awssh/run), each multiplexing the ssh connections of a user to an EC2 instance`,
+	}
+
+	command.AddCommand(makeSessionsList(), makeSessionsClose())
+	return command
+}
+
+func makeSessionsList() *cobra.Command {
+	var command = &cobra.Command{
+		Use:          "list",
+		Aliases:      []string{"ls"},
+		Short:        "List the open ssh ControlMasters",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		masters, err := ssh.ListMasters(config.GetRuntimeDir())
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "INSTANCE\tUSER\tPORT\tSOCKET")
+		for _, master := range masters {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", master.InstanceID, master.User, master.Port, master.Path)
+		}
+
+		return w.Flush()
+	}
+
+	return command
+}
+
+func makeSessionsClose() *cobra.Command {
+	var all bool
+
+	var command = &cobra.Command{
+		Use:   "close [<instance-id>...]",
+		Short: "Close the open ssh ControlMasters of the instances",
+		Example: `  awssh sessions close i-0387e016c47c6170c
+  awssh sessions close --all`,
+		ValidArgsFunction: completeSessions,
+		SilenceUsage:      true,
+	}
+
+	command.Flags().BoolVar(&all, "all", false, "Close all of the open ssh ControlMasters")
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		if all == (len(args) > 0) {
+			return errdefs.New(errdefs.ErrInvalidArgs, "either the instance-ids or --all is required")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		masters, err := ssh.ListMasters(config.GetRuntimeDir())
+		if err != nil {
+			return err
+		}
+
+		selected := make(map[string]bool, len(args))
+		for _, instanceID := range args {
+			selected[instanceID] = true
+		}
+
+		closed := make(map[string]bool, len(args))
+		for _, master := range masters {
+			if !all && !selected[master.InstanceID] {
+				continue
+			}
+
+			if err := master.Close(ctx); err != nil {
+				return err
+			}
+			closed[master.InstanceID] = true
+
+			logging.Logger().Infof("awssh: the ssh ControlMaster of '%s@%s' is closed", master.User, master.InstanceID)
+		}
+
+		for _, instanceID := range args {
+			if !closed[instanceID] {
+				return errdefs.New(errdefs.ErrNotFound, "no open ssh ControlMaster found for '%s'", instanceID)
+			}
+		}
+
+		return nil
+	}
+
+	return command
+}
+
+// completeSessions completes the arguments with the instance-ids of the open ssh ControlMasters
+func completeSessions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	masters, err := ssh.ListMasters(config.GetRuntimeDir())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	completions := make([]string, 0, len(masters))
+	for _, master := range masters {
+		completions = append(completions, master.InstanceID+"\t"+master.User+"@"+master.InstanceID+":"+master.Port)
+	}
+
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
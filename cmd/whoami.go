@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/spf13/cobra"
+
+	"awssh/config"
+	"awssh/internal/aws"
+	"awssh/internal/logging"
+)
+
+// MakeWhoami used to create whoami subcommand
+func MakeWhoami() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "whoami",
+		Short: "Show the AWS identity used by awssh",
+		Long:  "Show the AWS identity resolved from the credentials, the same identity used to access the EC2 instances",
+		Example: `  awssh whoami
+  awssh whoami --profile production`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+
+	config.AddAWSFlags(command.Flags())
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		awsConfig, err := aws.NewConfig(ctx, config.GetRegion(), config.GetProfile())
+		if err != nil {
+			return err
+		}
+
+		if err := ensureCredentials(ctx, awsConfig); err != nil {
+			return err
+		}
+
+		identityCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+		defer cancel()
+
+		identity, err := aws.GetCallerIdentity(identityCtx, sts.NewFromConfig(awsConfig))
+		if err != nil {
+			return err
+		}
+
+		profile := config.GetProfile()
+		if profile == "" {
+			profile = os.Getenv("AWS_PROFILE")
+		}
+
+		fmt.Fprintf(os.Stdout, "Account: %s\n", identity.Account)
+		fmt.Fprintf(os.Stdout, "ARN:     %s\n", identity.ARN)
+		fmt.Fprintf(os.Stdout, "UserID:  %s\n", identity.UserID)
+		fmt.Fprintf(os.Stdout, "Region:  %s\n", awsConfig.Region)
+		if profile != "" {
+			fmt.Fprintf(os.Stdout, "Profile: %s\n", profile)
+		}
+
+		return nil
+	}
+
+	return command
+}
+
+// newPreflight creates the permission preflight check and checks the permission to find the EC2 instances
+func newPreflight(ctx context.Context, awsConfig awssdk.Config) (*aws.Preflight, error) {
+	ctx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+	defer cancel()
+
+	preflight, err := aws.NewPreflight(ctx, sts.NewFromConfig(awsConfig), iam.NewFromConfig(awsConfig))
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Logger().Infof("awssh: preflight check as %s", preflight.Identity.ARN)
+
+	return preflight, checkPermissions(ctx, preflight, preflight.DescribeInstancesPermission())
+}
+
+// checkPermissions reports the simulated decision of each permission,
+// then fails on any permission which is not allowed
+func checkPermissions(ctx context.Context, preflight *aws.Preflight, permissions ...aws.Permission) error {
+	ctx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+	defer cancel()
+
+	results, err := preflight.Check(ctx, permissions...)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.Allowed() {
+			logging.Logger().Infof("awssh: preflight %s on %s: %s", result.Action, result.Resource, result.Decision)
+		} else {
+			logging.Logger().Errorf("awssh: preflight %s on %s: %s", result.Action, result.Resource, result.Decision)
+		}
+	}
+
+	return aws.MissingPermissions(preflight.PrincipalARN, results)
+}
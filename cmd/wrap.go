@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/spf13/cobra"
+
+	"awssh/config"
+	"awssh/internal/aws"
+	"awssh/internal/errdefs"
+	"awssh/internal/logging"
+	"awssh/internal/ssh"
+)
+
+// MakeWrap used to create wrap subcommand
+func MakeWrap() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "wrap -- <command> [args...]",
+		Short: "Run an ssh-based tool against EC2 instances referenced by their instance-id",
+		Long: `Run an ssh-based tool, e.g. rsync, scp, git or ansible, with the EC2 instances referenced by their instance-id.
+The ssh public key is pushed with EC2 Instance Connect to each of the referenced instances,
+and the tool is pointed at a temporary ssh config resolving the instance-ids to their IP addresses`,
+		Example: `  awssh wrap -- rsync -av ./dist i-0387e016c47c6170c:/srv/app
+  awssh wrap -- scp ubuntu@i-0387e016c47c6170c:/var/log/syslog .
+  awssh wrap -- git clone ssh://git@i-0387e016c47c6170c/srv/repo.git
+  awssh wrap --use-public-ip -- ansible all -i i-0387e016c47c6170c,i-0b22a22eec53b9321, -m ping`,
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+	}
+
+	config.AddWrapFlags(command.Flags())
+	// the flags after the command belong to the command, even without the '--' separator
+	command.Flags().SetInterspersed(false)
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		refs := aws.FindInstanceRefs(args[1:])
+		if len(refs) == 0 {
+			return errdefs.New(errdefs.ErrInvalidArgs, "no EC2 instance-id found in the command, e.g. i-0387e016c47c6170c:/srv/app")
+		}
+
+		sshOpts, err := ssh.Options("", config.GetSSHOpt())
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		awsConfig, err := aws.NewConfig(ctx, config.GetRegion(), config.GetProfile())
+		if err != nil {
+			return err
+		}
+
+		if err := ensureCredentials(ctx, awsConfig); err != nil {
+			return err
+		}
+
+		retryPolicy := aws.NewRetryPolicy(config.GetRetryMaxAttempts(), config.GetRetryBaseDelay(), config.GetRetryMaxDelay(), config.GetRetryErrorCodes()...)
+		noRetryConfig := aws.WithoutRetry(awsConfig)
+		ec2API := aws.NewRetryEC2Client(ec2.NewFromConfig(noRetryConfig), retryPolicy)
+		ec2InstanceConnectAPI := aws.NewRetryEC2InstanceConnectClient(ec2instanceconnect.NewFromConfig(noRetryConfig), retryPolicy)
+
+		if config.GetAudit() {
+			auditor, err := newAuditor(ctx, sts.NewFromConfig(awsConfig), awsConfig.Region, nil)
+			if err != nil {
+				return err
+			}
+			defer auditor.Close()
+		}
+
+		targets, err := wrapTargets(ctx, aws.NewProvider(ec2API), refs)
+		if err != nil {
+			return err
+		}
+
+		sshAgent, err := ssh.NewAgent()
+		if err != nil {
+			return err
+		}
+
+		hosts := make([]ssh.HostConfig, 0, len(targets))
+		for _, target := range targets {
+			knownHostsFile, strictMode, err := target.RecordHostKeys()
+			if err != nil {
+				return err
+			}
+
+			host := ssh.HostConfig{
+				Host:                  target.InstanceID,
+				User:                  config.GetSSHUsername(),
+				Port:                  config.GetSSHPort(),
+				HostKeyAlias:          target.InstanceID,
+				UserKnownHostsFile:    knownHostsFile,
+				StrictHostKeyChecking: strictMode,
+			}
+
+			host.HostName, _, err = target.Address(config.GetUsePublicIP())
+			if err != nil {
+				return err
+			}
+
+			if config.GetMultiplex() {
+				// ssh does not create the directory of the ControlPath
+				if err := ssh.MakeRuntimeDir(config.GetRuntimeDir()); err != nil {
+					return err
+				}
+
+				host.ControlMaster = "auto"
+				host.ControlPath = ssh.ControlPathPattern(config.GetRuntimeDir(), target.InstanceID)
+				host.ControlPersist = fmt.Sprintf("%ds", int(config.GetControlPersist().Seconds()))
+			}
+
+			for _, ref := range refs {
+				if ref.InstanceID != target.InstanceID {
+					continue
+				}
+
+				// the key is pushed even when a master is running, as the wrapped command cannot be retried
+				// when the master exits before the command connects and ssh starts a new master
+				sshSession, err := ssh.NewSession(sshAgent, target.InstanceID)
+				if err != nil {
+					return err
+				}
+				defer sshSession.Close() // nolint: errcheck
+
+				if _, err := target.PushSSHPublicKey(ctx, ec2InstanceConnectAPI, sshSession, ref.User, config.GetUsePublicIP()); err != nil {
+					return err
+				}
+			}
+
+			// the address is matched as well, for the tools given the address instead, e.g. the hosts of 'awssh inventory'
+			host.Host += " " + host.HostName
+			hosts = append(hosts, host)
+		}
+
+		tmpDir, err := os.MkdirTemp("", "awssh-wrap-")
+		if err != nil {
+			return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to create the temporary ssh config directory")
+		}
+		defer os.RemoveAll(tmpDir)
+
+		sshConfigFile := filepath.Join(tmpDir, "ssh_config")
+		if err := ssh.WriteConfig(sshConfigFile, hosts); err != nil {
+			return err
+		}
+
+		wrapCmd := wrapCommand(ctx, args, sshConfigFile, sshOpts)
+
+		logging.Logger().Debugf("awssh: running '%s' with the ssh config %s", ssh.JoinArgs(wrapCmd.Args), sshConfigFile)
+
+		err = wrapCmd.Run()
+		if ctx.Err() != nil {
+			return errdefs.Wrap(errdefs.ErrCancelled, ctx.Err(), "'%s' is interrupted", args[0])
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return &errdefs.ExitError{Code: exitErr.ExitCode()}
+		}
+		if err != nil {
+			return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to run '%s'", args[0])
+		}
+
+		return nil
+	}
+
+	return command
+}
+
+// wrapTargets get the EC2 instances of the references, each instance once in the order of the references
+func wrapTargets(ctx context.Context, provider *aws.Provider, refs []aws.InstanceRef) ([]*aws.Instance, error) {
+	discoveryCtx, cancel := aws.WithTimeout(ctx, config.GetTimeout())
+	defer cancel()
+
+	var (
+		targets []*aws.Instance
+		seen    = make(map[string]bool)
+	)
+
+	for _, ref := range refs {
+		if seen[ref.InstanceID] {
+			continue
+		}
+		seen[ref.InstanceID] = true
+
+		instances, err := provider.GetInstanceWithTarget(discoveryCtx, ref.InstanceID)
+		if err != nil {
+			return nil, err
+		}
+		target := instances[0]
+
+		if config.GetStrictHostKeyChecking() {
+			hostKeys, err := provider.GetHostKeys(discoveryCtx, target)
+			if err != nil {
+				logging.Logger().Warnf("awssh: unable to get host keys of EC2 instance '%s' (%s): %v", target.Name, target.InstanceID, err)
+			}
+			target.HostKeys = hostKeys
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// wrapCommand creates the command of the tool pointed at the ssh config. The ssh, scp and sftp are given the config with '-F',
+// while the tools running ssh on their own are given it with their environment variables, e.g. rsync, git and ansible
+func wrapCommand(ctx context.Context, args []string, sshConfigFile string, sshOpts []string) *exec.Cmd {
+	sshArgs := append([]string{"-F", sshConfigFile}, sshOpts...)
+
+	toolArgs := args[1:]
+	switch filepath.Base(args[0]) {
+	case "ssh", "scp", "sftp":
+		toolArgs = append(sshArgs, toolArgs...)
+	}
+
+	sshCommand := ssh.JoinArgs(append([]string{"ssh"}, sshArgs...))
+
+	cmd := exec.CommandContext(ctx, args[0], toolArgs...)
+	cmd.Env = append(os.Environ(),
+		"RSYNC_RSH="+sshCommand,
+		"GIT_SSH_COMMAND="+sshCommand,
+		"ANSIBLE_SSH_COMMON_ARGS="+ssh.JoinArgs(sshArgs),
+	)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd
+}
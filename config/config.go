@@ -2,6 +2,10 @@ package config
 
 import (
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/joeshaw/envdecode"
 	flag "github.com/spf13/pflag"
@@ -10,12 +14,57 @@ import (
 // Config represent the application configuration
 type config struct {
 	Debug       bool   `env:"AWSSH_DEBUG,default=0"`
+	LogFormat   string `env:"AWSSH_LOG_FORMAT,default=console"`
+	LogLevel    string `env:"AWSSH_LOG_LEVEL,default=info"`
+	LogFile     string `env:"AWSSH_LOG_FILE"`
+	ConfigFile  string `env:"AWSSH_CONFIG_FILE"`
 	Tags        string `env:"AWSSH_TAGS,default=Name=*"`
+	ASG         string `env:"AWSSH_ASG"`
 	SSHUsername string `env:"AWSSH_SSH_USERNAME,default=ec2-user"`
 	SSHPort     string `env:"AWSSH_SSH_PORT,default=22"`
-	SSHOpts     string `env:"AWSSH_SSH_OPTS,default=-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -o ConnectTimeout=5"`
+	SSHOpts     string `env:"AWSSH_SSH_OPTS,default=-o ConnectTimeout=5"`
+	SSHOpt      []string
 	UsePublicIP bool   `env:"AWSSH_USE_PUBLIC_IP,default=0"`
+	Preflight   bool   `env:"AWSSH_PREFLIGHT,default=0"`
 	Region      string `env:"AWS_DEFAULT_REGION"`
+	Profile     string `env:"AWS_PROFILE"`
+
+	RemoteCommand string `env:"AWSSH_REMOTE_COMMAND"`
+	Tmux          string `env:"AWSSH_TMUX"`
+
+	StrictHostKeyChecking bool   `env:"AWSSH_STRICT_HOST_KEY_CHECKING,default=1"`
+	KnownHostsFile        string `env:"AWSSH_KNOWN_HOSTS_FILE"`
+	HostKeyTags           bool   `env:"AWSSH_HOST_KEY_TAGS,default=0"`
+	AcceptChangedHostKey  bool   `env:"AWSSH_ACCEPT_CHANGED_HOST_KEY,default=0"`
+	RecordFile            string `env:"AWSSH_RECORD_FILE"`
+
+	Audit        bool   `env:"AWSSH_AUDIT"`
+	AuditLogFile string `env:"AWSSH_AUDIT_LOG_FILE"`
+	AuditSyslog  string `env:"AWSSH_AUDIT_SYSLOG"`
+
+	RetryMaxAttempts int           `env:"AWSSH_RETRY_MAX_ATTEMPTS,default=5"`
+	RetryBaseDelay   time.Duration `env:"AWSSH_RETRY_BASE_DELAY,default=200ms"`
+	RetryMaxDelay    time.Duration `env:"AWSSH_RETRY_MAX_DELAY,default=5s"`
+	RetryErrorCodes  string        `env:"AWSSH_RETRY_ERROR_CODES"`
+
+	Timeout time.Duration `env:"AWSSH_TIMEOUT,default=30s"`
+
+	CacheTTL time.Duration `env:"AWSSH_CACHE_TTL,default=5m"`
+
+	KeyPushCache bool `env:"AWSSH_KEY_PUSH_CACHE,default=1"`
+	ForcePush    bool `env:"AWSSH_FORCE_PUSH,default=0"`
+
+	Multiplex      bool          `env:"AWSSH_MULTIPLEX,default=0"`
+	ControlPersist time.Duration `env:"AWSSH_CONTROL_PERSIST,default=10m"`
+
+	RDPKeyFile   string `env:"AWSSH_RDP_KEY_FILE"`
+	RDPFile      string `env:"AWSSH_RDP_FILE"`
+	RDPUsername  string `env:"AWSSH_RDP_USERNAME,default=Administrator"`
+	RDPForward   string `env:"AWSSH_RDP_FORWARD"`
+	RDPBastion   string `env:"AWSSH_RDP_BASTION"`
+	RDPLocalPort int    `env:"AWSSH_RDP_LOCAL_PORT,default=33389"`
+
+	InventoryTags string `env:"AWSSH_INVENTORY_TAGS"`
 }
 
 var appConfig config
@@ -27,15 +76,135 @@ func Load() {
 	}
 }
 
+// AddLoggingFlags to populate flags used for the application logger
+func AddLoggingFlags(flagSet *flag.FlagSet) {
+	flagSet.BoolVarP(&appConfig.Debug, "debug", "d", appConfig.Debug, "Enabled debug mode")
+	flagSet.StringVar(&appConfig.LogFormat, "log-format", appConfig.LogFormat, "Log output format. Either console, json or logfmt")
+	flagSet.StringVar(&appConfig.LogLevel, "log-level", appConfig.LogLevel, "Log level. Either debug, info, warn or error")
+	flagSet.StringVar(&appConfig.LogFile, "log-file", appConfig.LogFile, "An optional file to write the logs in addition to stderr")
+}
+
+// AddConfigFileFlags to populate flags used for the awssh config file
+func AddConfigFileFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&appConfig.ConfigFile, "config-file", appConfig.ConfigFile, "The awssh config file holding the aliases. Default to ~/.awssh/config.yaml")
+}
+
 // AddEC2AccessFlags to populate flags used for accessing EC2
 func AddEC2AccessFlags(flagSet *flag.FlagSet) {
-	flagSet.BoolVarP(&appConfig.Debug, "debug", "d", appConfig.Debug, "Enabled debug mode")
-	flagSet.StringVar(&appConfig.Region, "region", appConfig.Region, "Default AWS region to be used. Either set AWS_REGION or AWS_DEFAULT_REGION")
+	AddAWSFlags(flagSet)
 	flagSet.StringVarP(&appConfig.Tags, "tags", "t", appConfig.Tags, "A comma-separated key-value pairs of EC2 tags. Ex: 'Name=ec2,Environment=staging'")
+	flagSet.StringVar(&appConfig.ASG, "asg", appConfig.ASG, "An auto-scaling group name, a random in-service instance of the group is selected")
 	flagSet.StringVarP(&appConfig.SSHUsername, "ssh-username", "u", appConfig.SSHUsername, "EC2 SSH username")
 	flagSet.StringVarP(&appConfig.SSHPort, "ssh-port", "p", appConfig.SSHPort, "An EC2 instance ssh port")
-	flagSet.StringVarP(&appConfig.SSHOpts, "ssh-opts", "o", appConfig.SSHOpts, "An additional ssh options")
+	flagSet.StringVarP(&appConfig.SSHOpts, "ssh-opts", "o", appConfig.SSHOpts, "An additional ssh options, parsed with the shell quoting rules. Ex: '-o \"ProxyCommand=nc %h %p\"'")
+	flagSet.StringArrayVar(&appConfig.SSHOpt, "ssh-opt", appConfig.SSHOpt, "An additional ssh '-o' option, can be repeated. Ex: 'ServerAliveInterval=60'")
+	flagSet.BoolVarP(&appConfig.UsePublicIP, "use-public-ip", "", appConfig.UsePublicIP, "Use public IP to access the EC2 instance")
+	flagSet.StringVar(&appConfig.RemoteCommand, "remote-command", appConfig.RemoteCommand, "A command to run on the EC2 instance after login, followed by an interactive shell. Ex: 'sudo -i'")
+	flagSet.StringVar(&appConfig.Tmux, "tmux", appConfig.Tmux, "A tmux session on the EC2 instance to attach, created when it does not exist")
+	flagSet.BoolVar(&appConfig.ForcePush, "force-push", appConfig.ForcePush, "Push the ssh public key even when the key pushed earlier is still valid")
+	flagSet.BoolVar(&appConfig.Multiplex, "multiplex", appConfig.Multiplex, "Multiplex the ssh connections to the EC2 instance through an ssh ControlMaster managed by awssh")
+	flagSet.DurationVar(&appConfig.ControlPersist, "control-persist", appConfig.ControlPersist, "Idle duration the ssh ControlMaster persists after the last connection, 0 means until 'awssh sessions close'")
+	flagSet.BoolVar(&appConfig.Preflight, "preflight", appConfig.Preflight, "Check the required IAM permissions with the IAM policy simulation before connecting")
+	flagSet.BoolVar(&appConfig.StrictHostKeyChecking, "strict-host-key-checking", appConfig.StrictHostKeyChecking, "Verify the EC2 instance ssh host keys against the keys published by the instance")
+	flagSet.StringVar(&appConfig.KnownHostsFile, "known-hosts-file", appConfig.KnownHostsFile, "An awssh-managed known_hosts file. Default to ~/.awssh/known_hosts")
+	flagSet.BoolVar(&appConfig.HostKeyTags, "host-key-tags", appConfig.HostKeyTags, "Trust the host keys of the 'awssh:host-key:' instance tags when the EC2 console output has none")
+	flagSet.BoolVar(&appConfig.AcceptChangedHostKey, "accept-changed-host-key", appConfig.AcceptChangedHostKey, "Replace the recorded host keys of the EC2 instance when they have changed, instead of refusing to connect")
+	flagSet.StringVar(&appConfig.RecordFile, "record", appConfig.RecordFile, "Record the ssh session into an asciicast v2 file")
+	flagSet.BoolVar(&appConfig.Audit, "audit", appConfig.Audit, "Emit an audit record for each connection attempt")
+	flagSet.StringVar(&appConfig.AuditLogFile, "audit-log-file", appConfig.AuditLogFile, "A JSON lines audit log file. Default to ~/.awssh/audit.log")
+	flagSet.StringVar(&appConfig.AuditSyslog, "audit-syslog", appConfig.AuditSyslog, "An optional syslog address to send the audit records. Ex: 'unixgram:///dev/log' or 'udp://127.0.0.1:514'")
+	flagSet.DurationVar(&appConfig.Timeout, "timeout", appConfig.Timeout, "Timeout of each of the discovery and connect phases, 0 means no timeout")
+	AddRetryFlags(flagSet)
+}
+
+// AddDoctorFlags to populate flags used for diagnosing the connectivity to EC2
+func AddDoctorFlags(flagSet *flag.FlagSet) {
+	AddAWSFlags(flagSet)
+	flagSet.StringVarP(&appConfig.SSHPort, "ssh-port", "p", appConfig.SSHPort, "An EC2 instance ssh port")
+	flagSet.BoolVarP(&appConfig.UsePublicIP, "use-public-ip", "", appConfig.UsePublicIP, "Use public IP to access the EC2 instance")
+	flagSet.DurationVar(&appConfig.Timeout, "timeout", appConfig.Timeout, "Timeout of the diagnosis, 0 means no timeout")
+	AddRetryFlags(flagSet)
+}
+
+// AddConsoleFlags to populate flags used for accessing the EC2 serial console
+func AddConsoleFlags(flagSet *flag.FlagSet) {
+	AddAWSFlags(flagSet)
+	flagSet.StringVarP(&appConfig.SSHOpts, "ssh-opts", "o", appConfig.SSHOpts, "An additional ssh options, parsed with the shell quoting rules")
+	flagSet.StringArrayVar(&appConfig.SSHOpt, "ssh-opt", appConfig.SSHOpt, "An additional ssh '-o' option, can be repeated")
+	flagSet.StringVar(&appConfig.KnownHostsFile, "known-hosts-file", appConfig.KnownHostsFile, "An awssh-managed known_hosts file. Default to ~/.awssh/known_hosts")
+	flagSet.DurationVar(&appConfig.Timeout, "timeout", appConfig.Timeout, "Timeout of each of the discovery and connect phases, 0 means no timeout")
+	AddRetryFlags(flagSet)
+}
+
+// AddRDPFlags to populate flags used for accessing the Windows EC2 instances with RDP
+func AddRDPFlags(flagSet *flag.FlagSet) {
+	AddAWSFlags(flagSet)
+	flagSet.StringVarP(&appConfig.RDPKeyFile, "key-file", "i", appConfig.RDPKeyFile, "The private key of the instance key pair to decrypt the password. Default to ~/.ssh/<key-name>.pem")
+	flagSet.StringVar(&appConfig.RDPFile, "rdp-file", appConfig.RDPFile, "The .rdp file to write. Default to ~/.awssh/rdp/<instance-id>.rdp")
+	flagSet.StringVarP(&appConfig.RDPUsername, "username", "u", appConfig.RDPUsername, "The Windows username")
+	flagSet.StringVar(&appConfig.RDPForward, "forward", appConfig.RDPForward, "Forward a local port to the RDP port of a private instance. Either ssm or bastion")
+	flagSet.StringVar(&appConfig.RDPBastion, "bastion", appConfig.RDPBastion, "The bastion target (instance-id, Name tag, IP or alias) to forward through with --forward=bastion")
+	flagSet.IntVar(&appConfig.RDPLocalPort, "local-port", appConfig.RDPLocalPort, "The local port of the forward")
+	flagSet.BoolVarP(&appConfig.UsePublicIP, "use-public-ip", "", appConfig.UsePublicIP, "Use public IP to access the EC2 instance")
+	flagSet.DurationVar(&appConfig.Timeout, "timeout", appConfig.Timeout, "Timeout of each of the discovery and password retrieval phases, 0 means no timeout")
+	AddRetryFlags(flagSet)
+}
+
+// AddWrapFlags to populate flags used for running an ssh-based tool against the EC2 instances
+func AddWrapFlags(flagSet *flag.FlagSet) {
+	AddAWSFlags(flagSet)
+	flagSet.StringVarP(&appConfig.SSHUsername, "ssh-username", "u", appConfig.SSHUsername, "EC2 SSH username of the instances referenced without a user")
+	flagSet.StringVarP(&appConfig.SSHPort, "ssh-port", "p", appConfig.SSHPort, "An EC2 instance ssh port")
+	flagSet.StringArrayVar(&appConfig.SSHOpt, "ssh-opt", appConfig.SSHOpt, "An additional ssh '-o' option, can be repeated. Ex: 'ServerAliveInterval=60'")
+	flagSet.BoolVarP(&appConfig.UsePublicIP, "use-public-ip", "", appConfig.UsePublicIP, "Use public IP to access the EC2 instances")
+	flagSet.BoolVar(&appConfig.ForcePush, "force-push", appConfig.ForcePush, "Push the ssh public key even when the key pushed earlier is still valid")
+	flagSet.BoolVar(&appConfig.Multiplex, "multiplex", appConfig.Multiplex, "Multiplex the ssh connections to the EC2 instance through an ssh ControlMaster managed by awssh")
+	flagSet.DurationVar(&appConfig.ControlPersist, "control-persist", appConfig.ControlPersist, "Idle duration the ssh ControlMaster persists after the last connection, 0 means until 'awssh sessions close'")
+	flagSet.BoolVar(&appConfig.StrictHostKeyChecking, "strict-host-key-checking", appConfig.StrictHostKeyChecking, "Verify the EC2 instance ssh host keys against the keys published by the instance")
+	flagSet.StringVar(&appConfig.KnownHostsFile, "known-hosts-file", appConfig.KnownHostsFile, "An awssh-managed known_hosts file. Default to ~/.awssh/known_hosts")
+	flagSet.BoolVar(&appConfig.HostKeyTags, "host-key-tags", appConfig.HostKeyTags, "Trust the host keys of the 'awssh:host-key:' instance tags when the EC2 console output has none")
+	flagSet.BoolVar(&appConfig.AcceptChangedHostKey, "accept-changed-host-key", appConfig.AcceptChangedHostKey, "Replace the recorded host keys of the EC2 instance when they have changed, instead of refusing to connect")
+	flagSet.BoolVar(&appConfig.Audit, "audit", appConfig.Audit, "Emit an audit record for each connection attempt")
+	flagSet.StringVar(&appConfig.AuditLogFile, "audit-log-file", appConfig.AuditLogFile, "A JSON lines audit log file. Default to ~/.awssh/audit.log")
+	flagSet.DurationVar(&appConfig.Timeout, "timeout", appConfig.Timeout, "Timeout of each of the discovery and key push phases, 0 means no timeout")
+	AddRetryFlags(flagSet)
+}
+
+// AddInventoryFlags to populate flags used for building the Ansible dynamic inventory of the EC2 instances
+func AddInventoryFlags(flagSet *flag.FlagSet) {
+	AddAWSFlags(flagSet)
+	flagSet.StringVarP(&appConfig.InventoryTags, "tags", "t", appConfig.InventoryTags, "A comma-separated key-value pairs of EC2 tags. Default to all of the running instances")
+	flagSet.StringVarP(&appConfig.SSHUsername, "ssh-username", "u", appConfig.SSHUsername, "EC2 SSH username of the inventory hosts")
+	flagSet.StringVarP(&appConfig.SSHPort, "ssh-port", "p", appConfig.SSHPort, "An EC2 instance ssh port")
+	flagSet.BoolVarP(&appConfig.UsePublicIP, "use-public-ip", "", appConfig.UsePublicIP, "Use public IP to access the EC2 instances")
+	flagSet.DurationVar(&appConfig.Timeout, "timeout", appConfig.Timeout, "Timeout of the discovery, 0 means no timeout")
+	AddRetryFlags(flagSet)
+}
+
+// AddProxyFlags to populate flags used for proxying an ssh connection to the EC2 instance
+func AddProxyFlags(flagSet *flag.FlagSet) {
+	AddAWSFlags(flagSet)
+	flagSet.StringVarP(&appConfig.SSHUsername, "ssh-username", "u", appConfig.SSHUsername, "EC2 SSH username to push the ssh public key for, e.g. '%r' in the ssh ProxyCommand")
 	flagSet.BoolVarP(&appConfig.UsePublicIP, "use-public-ip", "", appConfig.UsePublicIP, "Use public IP to access the EC2 instance")
+	flagSet.BoolVar(&appConfig.ForcePush, "force-push", appConfig.ForcePush, "Push the ssh public key even when the key pushed earlier is still valid")
+	flagSet.BoolVar(&appConfig.Audit, "audit", appConfig.Audit, "Emit an audit record for each connection attempt")
+	flagSet.StringVar(&appConfig.AuditLogFile, "audit-log-file", appConfig.AuditLogFile, "A JSON lines audit log file. Default to ~/.awssh/audit.log")
+	flagSet.DurationVar(&appConfig.Timeout, "timeout", appConfig.Timeout, "Timeout of each of the discovery, key push and connect phases, 0 means no timeout")
+	AddRetryFlags(flagSet)
+}
+
+// AddRetryFlags to populate flags used for retrying the throttled and failed AWS API calls
+func AddRetryFlags(flagSet *flag.FlagSet) {
+	flagSet.IntVar(&appConfig.RetryMaxAttempts, "retry-max-attempts", appConfig.RetryMaxAttempts, "Maximum attempts of the AWS API calls")
+	flagSet.DurationVar(&appConfig.RetryBaseDelay, "retry-base-delay", appConfig.RetryBaseDelay, "Base delay of the exponential backoff between retries")
+	flagSet.DurationVar(&appConfig.RetryMaxDelay, "retry-max-delay", appConfig.RetryMaxDelay, "Maximum delay of the exponential backoff between retries")
+	flagSet.StringVar(&appConfig.RetryErrorCodes, "retry-error-codes", appConfig.RetryErrorCodes, "A comma-separated AWS error codes to be retried. Default to throttling, service and network errors")
+}
+
+// AddAWSFlags to populate flags used for selecting the AWS region and shared config profile
+func AddAWSFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&appConfig.Region, "region", appConfig.Region, "Default AWS region to be used. Either set AWS_REGION or AWS_DEFAULT_REGION")
+	flagSet.StringVar(&appConfig.Profile, "profile", appConfig.Profile, "AWS shared config profile to be used. Default to AWS_PROFILE or the default profile")
 }
 
 // GetDebugMode get the debug mode flag
@@ -43,16 +212,46 @@ func GetDebugMode() bool {
 	return appConfig.Debug
 }
 
+// GetLogFormat get the log output format
+func GetLogFormat() string {
+	return appConfig.LogFormat
+}
+
+// GetLogLevel get the log level
+func GetLogLevel() string {
+	return appConfig.LogLevel
+}
+
+// GetLogFile get the log file path
+func GetLogFile() string {
+	return appConfig.LogFile
+}
+
 // GetRegion get AWS region
 func GetRegion() string {
 	return appConfig.Region
 }
 
+// GetProfile get AWS shared config profile
+func GetProfile() string {
+	return appConfig.Profile
+}
+
 // GetEC2Tags get EC2 tags
 func GetEC2Tags() string {
 	return appConfig.Tags
 }
 
+// GetInventoryTags get the EC2 tags of the inventory hosts, empty for all of the running instances
+func GetInventoryTags() string {
+	return appConfig.InventoryTags
+}
+
+// GetASG get the auto-scaling group name to select a random in-service instance from
+func GetASG() string {
+	return appConfig.ASG
+}
+
 // GetSSHUsername get SSH username
 func GetSSHUsername() string {
 	return appConfig.SSHUsername
@@ -68,7 +267,203 @@ func GetSSHOpts() string {
 	return appConfig.SSHOpts
 }
 
+// GetSSHOpt get the values of the repeatable ssh '-o' option
+func GetSSHOpt() []string {
+	return appConfig.SSHOpt
+}
+
 // GetUsePublicIP get the flag to access EC2 for using public ip or not
 func GetUsePublicIP() bool {
 	return appConfig.UsePublicIP
 }
+
+// GetRemoteCommand get the command to run on the EC2 instance after login
+func GetRemoteCommand() string {
+	return appConfig.RemoteCommand
+}
+
+// GetTmux get the tmux session to attach on the EC2 instance
+func GetTmux() string {
+	return appConfig.Tmux
+}
+
+// GetPreflight get the flag to check the required IAM permissions before connecting
+func GetPreflight() bool {
+	return appConfig.Preflight
+}
+
+// GetRDPKeyFile get the private key file to decrypt the Windows password
+func GetRDPKeyFile() string {
+	return appConfig.RDPKeyFile
+}
+
+// GetRDPFile get the .rdp file path
+func GetRDPFile() string {
+	return appConfig.RDPFile
+}
+
+// GetRDPDir get the directory of the .rdp files
+func GetRDPDir() string {
+	return filepath.Join(GetConfigDir(), "rdp")
+}
+
+// GetRDPUsername get the Windows username
+func GetRDPUsername() string {
+	return appConfig.RDPUsername
+}
+
+// GetRDPForward get the port forward mode of the RDP port
+func GetRDPForward() string {
+	return appConfig.RDPForward
+}
+
+// GetRDPBastion get the bastion target of the RDP port forward
+func GetRDPBastion() string {
+	return appConfig.RDPBastion
+}
+
+// GetRDPLocalPort get the local port of the RDP port forward
+func GetRDPLocalPort() int {
+	return appConfig.RDPLocalPort
+}
+
+// GetStrictHostKeyChecking get the flag to verify the EC2 instance ssh host keys
+func GetStrictHostKeyChecking() bool {
+	return appConfig.StrictHostKeyChecking
+}
+
+// GetHostKeyTags get the flag to trust the host keys of the instance tags, when the console output has none
+func GetHostKeyTags() bool {
+	return appConfig.HostKeyTags
+}
+
+// GetAcceptChangedHostKey get the flag to replace the changed host keys of the EC2 instance
+func GetAcceptChangedHostKey() bool {
+	return appConfig.AcceptChangedHostKey
+}
+
+// GetKnownHostsFile get the awssh-managed known_hosts file path
+func GetKnownHostsFile() string {
+	if appConfig.KnownHostsFile != "" {
+		return appConfig.KnownHostsFile
+	}
+
+	return filepath.Join(GetConfigDir(), "known_hosts")
+}
+
+// GetConfigDir get the awssh configuration directory (~/.awssh)
+func GetConfigDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.TempDir()
+	}
+
+	return filepath.Join(home, ".awssh")
+}
+
+// GetConfigFile get the awssh config file path
+func GetConfigFile() string {
+	if appConfig.ConfigFile != "" {
+		return appConfig.ConfigFile
+	}
+
+	return filepath.Join(GetConfigDir(), "config.yaml")
+}
+
+// GetCacheDir get the awssh cache directory (~/.awssh/cache)
+func GetCacheDir() string {
+	return filepath.Join(GetConfigDir(), "cache")
+}
+
+// GetCacheTTL get the time to live of the local instance cache used by the shell completion
+func GetCacheTTL() time.Duration {
+	return appConfig.CacheTTL
+}
+
+// GetKeyPushCache get the flag to skip re-pushing the ssh public key still valid on the instance
+func GetKeyPushCache() bool {
+	return appConfig.KeyPushCache
+}
+
+// GetKeyPushCacheFile get the state file of the pushed ssh public keys (~/.awssh/cache/pushed-keys.json)
+func GetKeyPushCacheFile() string {
+	return filepath.Join(GetCacheDir(), "pushed-keys.json")
+}
+
+// GetForcePush get the flag to push the ssh public key regardless of the key push cache
+func GetForcePush() bool {
+	return appConfig.ForcePush
+}
+
+// GetMultiplex get the flag to multiplex the ssh connections through an ssh ControlMaster
+func GetMultiplex() bool {
+	return appConfig.Multiplex
+}
+
+// GetControlPersist get the idle duration the ssh ControlMaster persists after the last connection
+func GetControlPersist() time.Duration {
+	return appConfig.ControlPersist
+}
+
+// GetRuntimeDir get the awssh runtime directory of the ssh ControlMaster sockets,
+// either $XDG_RUNTIME_DIR/awssh or ~/.awssh/run
+func GetRuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "awssh")
+	}
+
+	return filepath.Join(GetConfigDir(), "run")
+}
+
+// GetRecordFile get the asciicast file path to record the ssh session
+func GetRecordFile() string {
+	return appConfig.RecordFile
+}
+
+// GetAudit get the flag to emit audit records
+func GetAudit() bool {
+	return appConfig.Audit
+}
+
+// GetAuditLogFile get the audit log file path
+func GetAuditLogFile() string {
+	if appConfig.AuditLogFile != "" {
+		return appConfig.AuditLogFile
+	}
+
+	return filepath.Join(GetConfigDir(), "audit.log")
+}
+
+// GetAuditSyslog get the syslog address to send the audit records
+func GetAuditSyslog() string {
+	return appConfig.AuditSyslog
+}
+
+// GetRetryMaxAttempts get the maximum attempts of the AWS API calls
+func GetRetryMaxAttempts() int {
+	return appConfig.RetryMaxAttempts
+}
+
+// GetRetryBaseDelay get the base delay of the retry backoff
+func GetRetryBaseDelay() time.Duration {
+	return appConfig.RetryBaseDelay
+}
+
+// GetRetryMaxDelay get the maximum delay of the retry backoff
+func GetRetryMaxDelay() time.Duration {
+	return appConfig.RetryMaxDelay
+}
+
+// GetRetryErrorCodes get the AWS error codes to be retried
+func GetRetryErrorCodes() []string {
+	if appConfig.RetryErrorCodes == "" {
+		return nil
+	}
+
+	return strings.Split(appConfig.RetryErrorCodes, ",")
+}
+
+// GetTimeout get the timeout of each of the discovery and connect phases
+func GetTimeout() time.Duration {
+	return appConfig.Timeout
+}
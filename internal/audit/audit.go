@@ -0,0 +1,173 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"awssh/internal/logging"
+)
+
+// Audit event types
+const (
+	EventSendSSHPublicKey = "send-ssh-public-key"
+	EventSessionStart     = "session-start"
+	EventSessionEnd       = "session-end"
+)
+
+// Record represent a structured audit record of a connection attempt
+type Record struct {
+	Time           time.Time `json:"time"`
+	Event          string    `json:"event"`
+	CallerARN      string    `json:"caller_arn,omitempty"`
+	Region         string    `json:"region,omitempty"`
+	LocalUser      string    `json:"local_user,omitempty"`
+	InstanceID     string    `json:"instance_id"`
+	InstanceName   string    `json:"instance_name,omitempty"`
+	OSUser         string    `json:"os_user,omitempty"`
+	KeyFingerprint string    `json:"key_fingerprint,omitempty"`
+	Transport      string    `json:"transport,omitempty"`
+	Address        string    `json:"address,omitempty"`
+	Duration       float64   `json:"duration_seconds,omitempty"`
+	ExitStatus     *int      `json:"exit_status,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// Options represent the audit logger configuration
+type Options struct {
+	// File is the JSON lines audit log file path
+	File string
+	// Syslog is an optional syslog address, e.g. "unixgram:///dev/log" or "udp://127.0.0.1:514"
+	Syslog string
+	// CallerARN is the AWS identity used for the connection
+	CallerARN string
+	// Region is the AWS region used for the connection
+	Region string
+}
+
+// Auditor used to emit the audit records into the configured sinks
+type Auditor struct {
+	mu        sync.Mutex
+	sinks     []io.Writer
+	closers   []io.Closer
+	callerARN string
+	region    string
+	localUser string
+}
+
+var appAuditor *Auditor
+
+// NewAuditor used to initialize the application auditor
+func NewAuditor(opts Options) (*Auditor, error) {
+	auditor := &Auditor{
+		callerARN: opts.CallerARN,
+		region:    opts.Region,
+		localUser: localUser(),
+	}
+
+	if opts.File != "" {
+		if err := os.MkdirAll(filepath.Dir(opts.File), 0700); err != nil {
+			return nil, fmt.Errorf("awssh: unable to create audit log directory: (%v)", err)
+		}
+
+		f, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("awssh: unable to open audit log file: (%v)", err)
+		}
+
+		auditor.sinks = append(auditor.sinks, f)
+		auditor.closers = append(auditor.closers, f)
+	}
+
+	if opts.Syslog != "" {
+		w, err := dialSyslog(opts.Syslog)
+		if err != nil {
+			auditor.Close()
+			return nil, err
+		}
+
+		auditor.sinks = append(auditor.sinks, w)
+		auditor.closers = append(auditor.closers, w)
+	}
+
+	appAuditor = auditor
+	return auditor, nil
+}
+
+// Log emits an audit record using the application auditor
+// It is a no-op when the application auditor is not initialized
+func Log(record Record) {
+	if appAuditor == nil {
+		return
+	}
+
+	// the connection goes on without the record, yet the gap in the audit trail is reported
+	if err := appAuditor.Log(record); err != nil {
+		logging.Logger().Warnf("awssh: the '%s' audit record of EC2 instance %s is lost: %v", record.Event, record.InstanceID, err)
+	}
+}
+
+// Log emits an audit record into all of the sinks, a failing sink does not keep the record from the others
+func (a *Auditor) Log(record Record) error {
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	if record.CallerARN == "" {
+		record.CallerARN = a.callerARN
+	}
+	if record.Region == "" {
+		record.Region = a.region
+	}
+	if record.LocalUser == "" {
+		record.LocalUser = a.localUser
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var writeErr error
+	for _, sink := range a.sinks {
+		if _, err := sink.Write(b); err != nil && writeErr == nil {
+			writeErr = fmt.Errorf("awssh: unable to write audit record: (%v)", err)
+		}
+	}
+
+	return writeErr
+}
+
+// Close closes all of the sinks
+func (a *Auditor) Close() error {
+	for _, c := range a.closers {
+		c.Close()
+	}
+
+	if appAuditor == a {
+		appAuditor = nil
+	}
+
+	return nil
+}
+
+// ExitStatus is a helper to reference an exit status in a Record
+func ExitStatus(code int) *int {
+	return &code
+}
+
+func localUser() string {
+	for _, env := range []string{"USER", "USERNAME"} {
+		if u := os.Getenv(env); u != "" {
+			return u
+		}
+	}
+	return ""
+}
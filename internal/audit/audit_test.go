@@ -0,0 +1,113 @@
+package audit_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "awssh/internal/audit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditor(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "audit", "audit.log")
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	auditor, err := NewAuditor(Options{
+		File:      logFile,
+		Syslog:    "udp://" + conn.LocalAddr().String(),
+		CallerARN: "arn:aws:iam::123456789012:user/awssh",
+		Region:    "ap-southeast-1",
+	})
+	assert.Nil(t, err)
+
+	Log(Record{
+		Event:      EventSendSSHPublicKey,
+		InstanceID: "i-1234567890",
+		OSUser:     "ec2-user",
+		Transport:  "private-ip",
+	})
+	Log(Record{
+		Event:      EventSessionEnd,
+		InstanceID: "i-1234567890",
+		Duration:   1.5,
+		ExitStatus: ExitStatus(0),
+	})
+	assert.Nil(t, auditor.Close())
+
+	t.Run("records are written as JSON lines", func(t *testing.T) {
+		f, err := os.Open(logFile)
+		assert.Nil(t, err)
+		defer f.Close()
+
+		records := make([]Record, 0)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var record Record
+			assert.Nil(t, json.Unmarshal(scanner.Bytes(), &record))
+			records = append(records, record)
+		}
+
+		assert.Len(t, records, 2)
+		assert.Equal(t, EventSendSSHPublicKey, records[0].Event)
+		assert.Equal(t, "arn:aws:iam::123456789012:user/awssh", records[0].CallerARN)
+		assert.Equal(t, "ap-southeast-1", records[0].Region)
+		assert.False(t, records[0].Time.IsZero())
+		assert.Nil(t, records[0].ExitStatus)
+		assert.Equal(t, 0, *records[1].ExitStatus)
+		assert.Equal(t, 1.5, records[1].Duration)
+	})
+
+	t.Run("records are sent to syslog", func(t *testing.T) {
+		buf := make([]byte, 4096)
+		n, _, err := conn.ReadFrom(buf)
+		assert.Nil(t, err)
+
+		msg := string(buf[:n])
+		assert.True(t, strings.HasPrefix(msg, "<134>"))
+		assert.Contains(t, msg, `"event":"send-ssh-public-key"`)
+	})
+
+	t.Run("log without auditor is a no-op", func(t *testing.T) {
+		Log(Record{Event: EventSessionStart})
+	})
+}
+
+func TestNewAuditorBadSyslogAddress(t *testing.T) {
+	_, err := NewAuditor(Options{Syslog: "/dev/log"})
+	assert.NotNil(t, err)
+}
+
+func TestAuditorFailingSink(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full to fail the audit log file writes")
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	auditor, err := NewAuditor(Options{
+		File:   "/dev/full",
+		Syslog: "udp://" + conn.LocalAddr().String(),
+	})
+	assert.Nil(t, err)
+	defer auditor.Close()
+
+	err = auditor.Log(Record{Event: EventSessionStart, InstanceID: "i-1234567890"})
+	assert.NotNil(t, err)
+
+	// the record still reaches the other sinks
+	buf := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(t, err)
+	assert.Contains(t, string(buf[:n]), `"event":"session-start"`)
+}
@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// syslog facility local0 and severity info, see RFC 5424
+const syslogPriority = 16*8 + 6
+
+// syslogWriter writes each audit record as an RFC 3164 syslog message
+type syslogWriter struct {
+	conn     net.Conn
+	hostname string
+}
+
+// dialSyslog connects to the syslog address, e.g. "unixgram:///dev/log", "udp://127.0.0.1:514"
+func dialSyslog(address string) (*syslogWriter, error) {
+	u, err := url.Parse(address)
+	if err != nil || u.Scheme == "" {
+		return nil, fmt.Errorf("awssh: bad syslog address, must be using 'network://address' format: '%s'", address)
+	}
+
+	raddr := u.Host
+	if strings.HasPrefix(u.Scheme, "unix") {
+		raddr = u.Path
+	}
+
+	conn, err := net.Dial(u.Scheme, raddr)
+	if err != nil {
+		return nil, fmt.Errorf("awssh: unable to connect to syslog '%s': (%v)", address, err)
+	}
+
+	hostname, _ := os.Hostname()
+
+	return &syslogWriter{
+		conn:     conn,
+		hostname: hostname,
+	}, nil
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	msg := fmt.Sprintf("<%d>%s %s awssh[%d]: %s\n", syslogPriority, time.Now().Format(time.Stamp), s.hostname, os.Getpid(), strings.TrimSpace(string(p)))
+
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (s *syslogWriter) Close() error {
+	return s.conn.Close()
+}
@@ -1,38 +1,61 @@
 package aws
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 
+	"awssh/internal/errdefs"
 	"awssh/internal/logging"
 )
 
-// NewSession creates a new AWS session from region input or region environment variables (ex: AWS_DEFAULT_REGION, AWS_REGION)
+// NewConfig creates a new AWS config from region input or region environment variables (ex: AWS_REGION)
 // all the credentials loaded in a common way of AWS credentials such as,
-// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables
-// or loaded from AWS shared-credentials located in ~/.aws/credentials
-// in particularly when you need to use AWS_PROFILE located in ~/.aws/config
-// you need to set AWS_SDK_LOAD_CONFIG=1
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables,
+// AWS_PROFILE from the shared config and credentials files (~/.aws/config, ~/.aws/credentials)
+// including the SSO and credential_process profiles, an empty profile means AWS_PROFILE or the default profile
 //
 // Sidenote
-// session.Must(): the only way the session is failed if the shared config is malformed
-// ref: https://github.com/aws/aws-sdk-go/issues/928
-func NewSession(region string) *session.Session {
-	session := session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(region),
-	}))
+// the only way the config is failed if the shared config is malformed
+func NewConfig(ctx context.Context, region, profile string) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region), config.WithSharedConfigProfile(profile))
+	if err != nil {
+		return cfg, errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to load AWS config")
+	}
+
+	logging.Logger().Debugf("Region: %s", cfg.Region)
 
-	logging.Logger().Debugf("Region: %s", *session.Config.Region)
+	return cfg, nil
+}
+
+// WithoutRetry returns a copy of the AWS config with the SDK retries disabled,
+// used when the retries are handled by the awssh RetryPolicy
+func WithoutRetry(cfg aws.Config) aws.Config {
+	cfg = cfg.Copy()
+	cfg.Retryer = func() aws.Retryer {
+		return aws.NopRetryer{}
+	}
+
+	return cfg
+}
+
+// WithTimeout returns a copy of the context with the timeout,
+// a non-positive timeout means no timeout
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
 
-	return session
+	return context.WithTimeout(ctx, timeout)
 }
 
-func PrepareEC2Filters(tags string) ([]*ec2.Filter, error) {
-	awsTags := make(map[string][]*string)
+func PrepareEC2Filters(tags string) ([]types.Filter, error) {
+	awsTags := make(map[string][]string)
 
 	splitTags := strings.Split(tags, ",")
 
@@ -40,24 +63,24 @@ func PrepareEC2Filters(tags string) ([]*ec2.Filter, error) {
 		part := strings.Split(tags, "=")
 
 		if len(part) != 2 {
-			return nil, fmt.Errorf("awssh: bad input, filters must be using 'Key=Value' format: '%s'", tags)
+			return nil, errdefs.New(errdefs.ErrInvalidArgs, "bad input, filters must be using 'Key=Value' format: '%s'", tags)
 		}
 
 		key := part[0]
-		value := aws.String(part[1])
+		value := part[1]
 		awsTags[key] = append(awsTags[key], value)
 	}
 
-	filters := make([]*ec2.Filter, 0)
-	filters = append(filters, &ec2.Filter{
+	filters := make([]types.Filter, 0)
+	filters = append(filters, types.Filter{
 		Name: aws.String("instance-state-name"),
-		Values: []*string{
-			aws.String("running"),
+		Values: []string{
+			"running",
 		},
 	})
 
 	for k, v := range awsTags {
-		f := &ec2.Filter{
+		f := types.Filter{
 			Name:   aws.String(fmt.Sprintf("tag:%s", k)),
 			Values: v,
 		}
@@ -67,7 +90,7 @@ func PrepareEC2Filters(tags string) ([]*ec2.Filter, error) {
 	return filters, nil
 }
 
-func GetTagValue(key string, instance *ec2.Instance) string {
+func GetTagValue(key string, instance *types.Instance) string {
 	for _, tag := range instance.Tags {
 		if *tag.Key == key {
 			return *tag.Value
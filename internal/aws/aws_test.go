@@ -1,19 +1,21 @@
 package aws_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	. "awssh/internal/aws"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestNewSession(t *testing.T) {
-	session := NewSession("ap-southeast-1")
-	assert.NotNil(t, session)
+func TestNewConfig(t *testing.T) {
+	cfg, err := NewConfig(context.Background(), "ap-southeast-1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "ap-southeast-1", cfg.Region)
 }
 
 func TestPrepareEC2Filters(t *testing.T) {
@@ -21,11 +23,11 @@ func TestPrepareEC2Filters(t *testing.T) {
 		tags string
 	}
 
-	defaultFilters := []*ec2.Filter{
+	defaultFilters := []types.Filter{
 		{
 			Name: aws.String("instance-state-name"),
-			Values: []*string{
-				aws.String("running"),
+			Values: []string{
+				"running",
 			},
 		},
 	}
@@ -33,7 +35,7 @@ func TestPrepareEC2Filters(t *testing.T) {
 	tests := []struct {
 		name     string
 		args     args
-		expected []*ec2.Filter
+		expected []types.Filter
 		err      error
 	}{
 		{
@@ -52,10 +54,10 @@ func TestPrepareEC2Filters(t *testing.T) {
 			name: "single tag",
 			args: args{"Environment=production"},
 			expected: append(defaultFilters,
-				&ec2.Filter{
+				types.Filter{
 					Name: aws.String("tag:Environment"),
-					Values: []*string{
-						aws.String("production"),
+					Values: []string{
+						"production",
 					},
 				},
 			),
@@ -65,16 +67,16 @@ func TestPrepareEC2Filters(t *testing.T) {
 			name: "multiple tags with comma delimiters",
 			args: args{"Environment=production,Service=promotion"},
 			expected: append(defaultFilters,
-				&ec2.Filter{
+				types.Filter{
 					Name: aws.String("tag:Environment"),
-					Values: []*string{
-						aws.String("production"),
+					Values: []string{
+						"production",
 					},
 				},
-				&ec2.Filter{
+				types.Filter{
 					Name: aws.String("tag:Service"),
-					Values: []*string{
-						aws.String("promotion"),
+					Values: []string{
+						"promotion",
 					},
 				},
 			),
@@ -97,8 +99,8 @@ func TestPrepareEC2Filters(t *testing.T) {
 }
 
 func TestGetTagValue(t *testing.T) {
-	defaultInstance := &ec2.Instance{
-		Tags: []*ec2.Tag{
+	defaultInstance := &types.Instance{
+		Tags: []types.Tag{
 			{
 				Key:   aws.String("Environment"),
 				Value: aws.String("production"),
@@ -108,7 +110,7 @@ func TestGetTagValue(t *testing.T) {
 
 	type args struct {
 		key      string
-		instance *ec2.Instance
+		instance *types.Instance
 	}
 
 	tests := []struct {
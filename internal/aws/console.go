@@ -0,0 +1,124 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
+	"golang.org/x/crypto/ssh/agent"
+
+	"awssh/config"
+	"awssh/internal/audit"
+	"awssh/internal/errdefs"
+	"awssh/internal/logging"
+	"awssh/internal/ssh"
+)
+
+// CheckSerialConsoleAccess checks the EC2 serial console access is enabled for the account in the region of the client
+func CheckSerialConsoleAccess(ctx context.Context, client EC2API) error {
+	out, err := client.GetSerialConsoleAccessStatus(ctx, &ec2.GetSerialConsoleAccessStatusInput{})
+	if err != nil {
+		return wrapError(err, "unable to get the EC2 serial console access status")
+	}
+
+	if !aws.ToBool(out.SerialConsoleAccessEnabled) {
+		return errdefs.New(errdefs.ErrAuthDenied, "EC2 serial console access is disabled for the account, "+
+			"enable it with 'aws ec2 enable-serial-console-access' or in the EC2 console settings")
+	}
+
+	return nil
+}
+
+// SerialConsoleAddress get the ssh destination of the serial console port 0 of the instance
+func (e *Instance) SerialConsoleAddress(region string) string {
+	return fmt.Sprintf("%s.port0@%s", e.InstanceID, serialConsoleEndpoint(region))
+}
+
+// serialConsoleEndpoint get the EC2 serial console endpoint of the region, shared by all of the instances
+func serialConsoleEndpoint(region string) string {
+	return fmt.Sprintf("serial-console.ec2-instance-connect.%s.aws", region)
+}
+
+// serialConsoleHostKeyOpts get the ssh options to verify the host key of the serial console endpoint.
+// The endpoint does not publish its host keys through the API, so its key is trusted on first use
+// into the awssh-managed known_hosts keyed by the endpoint, and the key changing afterwards is refused by ssh
+func serialConsoleHostKeyOpts(region string) ([]string, error) {
+	knownHosts, err := ssh.NewKnownHosts(config.GetKnownHostsFile())
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "UserKnownHostsFile=" + knownHosts.Path,
+		"-o", "HostKeyAlias=" + serialConsoleEndpoint(region),
+	}, nil
+}
+
+// ConnectSerialConsole used to establish an ssh connection to the EC2 serial console of the instance,
+// which is accessible even when the network or the sshd of the instance is broken
+func (e *Instance) ConnectSerialConsole(ctx context.Context, sshAgent agent.ExtendedAgent, client EC2InstanceConnectAPI, cmdFn ShellCommandFunc, region string) (err error) {
+	sshOpts, err := ssh.Options(config.GetSSHOpts(), config.GetSSHOpt())
+	if err != nil {
+		return err
+	}
+
+	sshSession, err := ssh.NewSession(sshAgent, e.InstanceID)
+	if err != nil {
+		return
+	}
+
+	// the temporary ssh keypair lives as long as the ssh session
+	defer sshSession.Close() // nolint: errcheck
+
+	address := e.SerialConsoleAddress(region)
+
+	connectCtx, cancel := WithTimeout(ctx, config.GetTimeout())
+	defer cancel()
+
+	err = e.sendSerialConsoleSSHPublicKey(connectCtx, client, sshSession.PublicKey)
+	e.audit(audit.Record{
+		Event:          audit.EventSendSSHPublicKey,
+		KeyFingerprint: sshSession.Fingerprint,
+		Transport:      TransportSerialConsole,
+		Address:        address,
+	}, err)
+	if err != nil {
+		return err
+	}
+
+	logging.Logger().Infof("awssh: connecting to the serial console of EC2 instance '%s' (%s), press Enter for the login prompt and '~.' to disconnect", e.Name, e.InstanceID)
+
+	// ssh keeps the first value of an option, so the host key verification is placed before the user ssh options
+	sshArgs, err := serialConsoleHostKeyOpts(region)
+	if err != nil {
+		return err
+	}
+	sshArgs = append(sshArgs, sshOpts...)
+	sshArgs = append(sshArgs, address)
+
+	return e.runSSH(ctx, cmdFn, sshArgs, audit.Record{
+		KeyFingerprint: sshSession.Fingerprint,
+		Transport:      TransportSerialConsole,
+		Address:        address,
+	})
+}
+
+// sendSerialConsoleSSHPublicKey sends the ssh public key for the serial console port 0 of the instance
+func (e *Instance) sendSerialConsoleSSHPublicKey(ctx context.Context, client EC2InstanceConnectAPI, publicKey string) error {
+	input := &ec2instanceconnect.SendSerialConsoleSSHPublicKeyInput{
+		InstanceId:   aws.String(e.InstanceID),
+		SSHPublicKey: aws.String(publicKey),
+		SerialPort:   0,
+	}
+
+	logging.Logger().Debugf("Sending SSH Public Key for the serial console of EC2 instance '%s' (%s)", e.Name, e.InstanceID)
+
+	if _, err := client.SendSerialConsoleSSHPublicKey(ctx, input); err != nil {
+		return wrapError(err, "unable to send serial console ssh public key to EC2 instance '%s' (%s)", e.Name, e.InstanceID)
+	}
+
+	return nil
+}
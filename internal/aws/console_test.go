@@ -0,0 +1,83 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+
+	"awssh/config"
+	"awssh/internal/errdefs"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSerialConsoleEC2 struct {
+	EC2API
+
+	enabled bool
+}
+
+func (m mockSerialConsoleEC2) GetSerialConsoleAccessStatus(ctx context.Context, input *ec2.GetSerialConsoleAccessStatusInput, optFns ...func(*ec2.Options)) (*ec2.GetSerialConsoleAccessStatusOutput, error) {
+	return &ec2.GetSerialConsoleAccessStatusOutput{SerialConsoleAccessEnabled: aws.Bool(m.enabled)}, nil
+}
+
+type mockSerialConsoleAPI struct {
+	EC2InstanceConnectAPI
+
+	err   error
+	input *ec2instanceconnect.SendSerialConsoleSSHPublicKeyInput
+}
+
+func (m *mockSerialConsoleAPI) SendSerialConsoleSSHPublicKey(ctx context.Context, input *ec2instanceconnect.SendSerialConsoleSSHPublicKeyInput, optFns ...func(*ec2instanceconnect.Options)) (*ec2instanceconnect.SendSerialConsoleSSHPublicKeyOutput, error) {
+	m.input = input
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &ec2instanceconnect.SendSerialConsoleSSHPublicKeyOutput{Success: true}, nil
+}
+
+func TestCheckSerialConsoleAccess(t *testing.T) {
+	assert.Nil(t, CheckSerialConsoleAccess(context.Background(), mockSerialConsoleEC2{enabled: true}))
+
+	err := CheckSerialConsoleAccess(context.Background(), mockSerialConsoleEC2{enabled: false})
+	assert.True(t, errors.Is(err, errdefs.ErrAuthDenied))
+}
+
+func TestConnectSerialConsole(t *testing.T) {
+	instance := NewInstance(&ec2types.Instance{
+		InstanceId:       aws.String("i-0387e016c47c6170c"),
+		PrivateIpAddress: aws.String("10.10.5.100"),
+		Placement:        &ec2types.Placement{AvailabilityZone: aws.String("ap-southeast-1a")},
+	})
+
+	var sshArgs []string
+	shellCommand := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		sshArgs = args
+		return fakeShellCommand()(ctx, name, args...)
+	}
+
+	client := &mockSerialConsoleAPI{}
+	err := instance.ConnectSerialConsole(context.Background(), mockSSHAgent{}, client, shellCommand, "ap-southeast-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "i-0387e016c47c6170c", *client.input.InstanceId)
+	assert.Equal(t, int32(0), client.input.SerialPort)
+	assert.Equal(t, "i-0387e016c47c6170c.port0@serial-console.ec2-instance-connect.ap-southeast-1.aws", sshArgs[len(sshArgs)-1])
+	assert.Equal(t, []string{
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "UserKnownHostsFile=" + config.GetKnownHostsFile(),
+		"-o", "HostKeyAlias=serial-console.ec2-instance-connect.ap-southeast-1.aws",
+	}, sshArgs[:6])
+
+	t.Run("serial console session limit", func(t *testing.T) {
+		client := &mockSerialConsoleAPI{err: &types.SerialConsoleSessionLimitExceededException{Message: aws.String("session limit")}}
+
+		err := instance.ConnectSerialConsole(context.Background(), mockSSHAgent{}, client, shellCommand, "ap-southeast-1")
+		assert.True(t, errors.Is(err, errdefs.ErrThrottled))
+	})
+}
@@ -0,0 +1,473 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+
+	"awssh/internal/errdefs"
+)
+
+// EC2InstanceConnectTag is the EC2 instance tag telling whether the ec2-instance-connect package is installed,
+// either "true" or "false", it takes precedence over the AMI detection
+const EC2InstanceConnectTag = "awssh:ec2-instance-connect"
+
+// ec2InstanceConnectAMIs is the AMI name patterns which have the ec2-instance-connect package preinstalled
+var ec2InstanceConnectAMIs = []string{
+	"amzn2-ami-",
+	"al2023-ami-",
+	"ubuntu-focal-20.04",
+	"ubuntu-jammy-22.04",
+	"ubuntu-noble-24.04",
+}
+
+// ephemeralPort is a port of the Linux ephemeral port range used by the ssh client,
+// the network ACLs are stateless so the return traffic must be allowed on it
+const ephemeralPort = 32768
+
+// CheckStatus is the result status of a doctor check
+type CheckStatus string
+
+// Statuses of a doctor check
+const (
+	CheckOK   CheckStatus = "ok"
+	CheckWarn CheckStatus = "warn"
+	CheckFail CheckStatus = "fail"
+	CheckSkip CheckStatus = "skip"
+)
+
+// Check represent the result of a connectivity check
+type Check struct {
+	Name   string
+	Status CheckStatus
+	Detail string
+}
+
+// DoctorOptions represent the connection settings to be diagnosed
+type DoctorOptions struct {
+	Port         int
+	UsePublicIP  bool
+	ProbeTimeout time.Duration
+}
+
+// Doctor diagnoses the ssh connectivity to an EC2 instance
+type Doctor struct {
+	EC2 EC2API
+	// SSM is optional, the SSM check is skipped without it
+	SSM SSMAPI
+
+	dial func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// NewDoctor creates a new Doctor
+func NewDoctor(ec2API EC2API, ssmAPI SSMAPI) *Doctor {
+	return &Doctor{
+		EC2:  ec2API,
+		SSM:  ssmAPI,
+		dial: (&net.Dialer{}).DialContext,
+	}
+}
+
+// Diagnose runs the connectivity checks of the EC2 instance,
+// a check which is unable to get its data (e.g. missing permission) is skipped instead of failing the diagnosis
+func (d *Doctor) Diagnose(ctx context.Context, instanceID string, opts DoctorOptions) ([]Check, error) {
+	out, err := d.EC2.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		return nil, wrapError(err, "unable to describe EC2 instances")
+	}
+
+	if len(out.Reservations) == 0 || len(out.Reservations[0].Instances) == 0 {
+		return nil, errdefs.New(errdefs.ErrNotFound, "no instance found")
+	}
+
+	instance := &out.Reservations[0].Instances[0]
+
+	return []Check{
+		d.checkState(instance),
+		d.checkAddress(instance, opts),
+		d.checkSecurityGroups(ctx, instance, opts),
+		d.checkNetworkACL(ctx, instance, opts),
+		d.checkRouteTable(ctx, instance, opts),
+		d.checkEC2InstanceConnect(ctx, instance),
+		d.checkSSM(ctx, instance),
+		d.checkTCPProbe(ctx, instance, opts),
+	}, nil
+}
+
+func (d *Doctor) checkState(instance *types.Instance) Check {
+	check := Check{Name: "instance-state"}
+
+	state := types.InstanceStateNamePending
+	if instance.State != nil {
+		state = instance.State.Name
+	}
+
+	if state != types.InstanceStateNameRunning {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("instance is %s, it must be running", state)
+		return check
+	}
+
+	check.Status = CheckOK
+	check.Detail = "instance is running"
+	return check
+}
+
+func (d *Doctor) checkAddress(instance *types.Instance, opts DoctorOptions) Check {
+	check := Check{Name: "address"}
+	publicIP := aws.ToString(instance.PublicIpAddress)
+
+	switch {
+	case opts.UsePublicIP && publicIP == "":
+		check.Status = CheckFail
+		check.Detail = "instance has no public IP, connect without --use-public-ip"
+	case opts.UsePublicIP:
+		check.Status = CheckOK
+		check.Detail = fmt.Sprintf("connecting to the public IP %s", publicIP)
+	case publicIP != "":
+		check.Status = CheckOK
+		check.Detail = fmt.Sprintf("connecting to the private IP %s, the public IP %s is available with --use-public-ip", aws.ToString(instance.PrivateIpAddress), publicIP)
+	default:
+		check.Status = CheckOK
+		check.Detail = fmt.Sprintf("connecting to the private IP %s", aws.ToString(instance.PrivateIpAddress))
+	}
+
+	return check
+}
+
+func (d *Doctor) checkSecurityGroups(ctx context.Context, instance *types.Instance, opts DoctorOptions) Check {
+	check := Check{Name: "security-groups"}
+
+	groupIDs := make([]string, 0, len(instance.SecurityGroups))
+	for _, group := range instance.SecurityGroups {
+		groupIDs = append(groupIDs, aws.ToString(group.GroupId))
+	}
+
+	if len(groupIDs) == 0 {
+		check.Status = CheckFail
+		check.Detail = "instance has no security groups"
+		return check
+	}
+
+	out, err := d.EC2.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{GroupIds: groupIDs})
+	if err != nil {
+		return skipCheck(check, err)
+	}
+
+	var sources []string
+	for _, group := range out.SecurityGroups {
+		for _, permission := range group.IpPermissions {
+			if !allowsPort(aws.ToString(permission.IpProtocol), permission.FromPort, permission.ToPort, opts.Port) {
+				continue
+			}
+
+			for _, r := range permission.IpRanges {
+				sources = append(sources, aws.ToString(r.CidrIp))
+			}
+			for _, r := range permission.Ipv6Ranges {
+				sources = append(sources, aws.ToString(r.CidrIpv6))
+			}
+			for _, r := range permission.PrefixListIds {
+				sources = append(sources, aws.ToString(r.PrefixListId))
+			}
+			for _, r := range permission.UserIdGroupPairs {
+				sources = append(sources, aws.ToString(r.GroupId))
+			}
+		}
+	}
+
+	if len(sources) == 0 {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("no inbound rule of %s allows tcp/%d", strings.Join(groupIDs, ", "), opts.Port)
+		return check
+	}
+
+	check.Status = CheckOK
+	check.Detail = fmt.Sprintf("tcp/%d is allowed from %s, your source address must be one of them", opts.Port, strings.Join(sources, ", "))
+	return check
+}
+
+func (d *Doctor) checkNetworkACL(ctx context.Context, instance *types.Instance, opts DoctorOptions) Check {
+	check := Check{Name: "network-acl"}
+
+	out, err := d.EC2.DescribeNetworkAcls(ctx, &ec2.DescribeNetworkAclsInput{
+		Filters: []types.Filter{
+			{Name: aws.String("association.subnet-id"), Values: []string{aws.ToString(instance.SubnetId)}},
+		},
+	})
+	if err != nil {
+		return skipCheck(check, err)
+	}
+
+	if len(out.NetworkAcls) == 0 {
+		check.Status = CheckSkip
+		check.Detail = fmt.Sprintf("no network ACL is associated with the subnet %s", aws.ToString(instance.SubnetId))
+		return check
+	}
+
+	acl := out.NetworkAcls[0]
+	aclID := aws.ToString(acl.NetworkAclId)
+
+	if allowed, rule := aclAllowsPort(acl.Entries, false, opts.Port); !allowed {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("inbound tcp/%d is denied by %s (rule %s)", opts.Port, aclID, rule)
+		return check
+	}
+
+	if allowed, rule := aclAllowsPort(acl.Entries, true, ephemeralPort); !allowed {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("outbound return traffic to the ephemeral ports is denied by %s (rule %s)", aclID, rule)
+		return check
+	}
+
+	check.Status = CheckOK
+	check.Detail = fmt.Sprintf("%s allows inbound tcp/%d and the outbound return traffic", aclID, opts.Port)
+	return check
+}
+
+func (d *Doctor) checkRouteTable(ctx context.Context, instance *types.Instance, opts DoctorOptions) Check {
+	check := Check{Name: "route-table"}
+	subnetID := aws.ToString(instance.SubnetId)
+
+	out, err := d.EC2.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{
+		Filters: []types.Filter{
+			{Name: aws.String("association.subnet-id"), Values: []string{subnetID}},
+		},
+	})
+	if err == nil && len(out.RouteTables) == 0 {
+		// the subnet without an explicit association uses the main route table of the VPC
+		out, err = d.EC2.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{
+			Filters: []types.Filter{
+				{Name: aws.String("vpc-id"), Values: []string{aws.ToString(instance.VpcId)}},
+				{Name: aws.String("association.main"), Values: []string{"true"}},
+			},
+		})
+	}
+	if err != nil {
+		return skipCheck(check, err)
+	}
+
+	if len(out.RouteTables) == 0 {
+		check.Status = CheckSkip
+		check.Detail = fmt.Sprintf("no route table is associated with the subnet %s", subnetID)
+		return check
+	}
+
+	table := out.RouteTables[0]
+	tableID := aws.ToString(table.RouteTableId)
+	defaultTarget := defaultRouteTarget(table.Routes)
+
+	if opts.UsePublicIP {
+		if !strings.HasPrefix(defaultTarget, "igw-") {
+			check.Status = CheckFail
+			check.Detail = fmt.Sprintf("%s of the subnet %s has no default route to an internet gateway, the public IP is unreachable", tableID, subnetID)
+			return check
+		}
+
+		check.Status = CheckOK
+		check.Detail = fmt.Sprintf("%s routes the internet traffic through %s", tableID, defaultTarget)
+		return check
+	}
+
+	check.Status = CheckOK
+	check.Detail = fmt.Sprintf("the private IP is routed within %s, it must be reachable from your network (VPN, peering, Direct Connect or a bastion)", aws.ToString(instance.VpcId))
+	return check
+}
+
+func (d *Doctor) checkEC2InstanceConnect(ctx context.Context, instance *types.Instance) Check {
+	check := Check{Name: "ec2-instance-connect"}
+
+	if instance.Platform == types.PlatformValuesWindows {
+		check.Status = CheckFail
+		check.Detail = "Windows instances are not supported by EC2 Instance Connect"
+		return check
+	}
+
+	switch GetTagValue(EC2InstanceConnectTag, instance) {
+	case "true":
+		check.Status = CheckOK
+		check.Detail = fmt.Sprintf("ec2-instance-connect is installed according to the %s tag", EC2InstanceConnectTag)
+		return check
+	case "false":
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("ec2-instance-connect is not installed according to the %s tag", EC2InstanceConnectTag)
+		return check
+	}
+
+	imageID := aws.ToString(instance.ImageId)
+	out, err := d.EC2.DescribeImages(ctx, &ec2.DescribeImagesInput{ImageIds: []string{imageID}})
+	if err != nil {
+		return skipCheck(check, err)
+	}
+
+	if len(out.Images) == 0 {
+		check.Status = CheckWarn
+		check.Detail = fmt.Sprintf("unable to find the AMI %s, make sure ec2-instance-connect is installed", imageID)
+		return check
+	}
+
+	name := aws.ToString(out.Images[0].Name)
+	for _, pattern := range ec2InstanceConnectAMIs {
+		if strings.Contains(name, pattern) {
+			check.Status = CheckOK
+			check.Detail = fmt.Sprintf("ec2-instance-connect is preinstalled on the AMI %s", name)
+			return check
+		}
+	}
+
+	check.Status = CheckWarn
+	check.Detail = fmt.Sprintf("ec2-instance-connect may not be installed on the AMI %s, set the %s tag once verified", name, EC2InstanceConnectTag)
+	return check
+}
+
+func (d *Doctor) checkSSM(ctx context.Context, instance *types.Instance) Check {
+	check := Check{Name: "ssm"}
+	instanceID := aws.ToString(instance.InstanceId)
+
+	if d.SSM == nil {
+		check.Status = CheckSkip
+		check.Detail = "SSM is not checked"
+		return check
+	}
+
+	out, err := d.SSM.DescribeInstanceInformation(ctx, &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmtypes.InstanceInformationStringFilter{
+			{Key: aws.String("InstanceIds"), Values: []string{instanceID}},
+		},
+	})
+	if err != nil {
+		return skipCheck(check, err)
+	}
+
+	if len(out.InstanceInformationList) == 0 {
+		check.Status = CheckWarn
+		check.Detail = "instance is not managed by SSM, no fallback access through Session Manager"
+		return check
+	}
+
+	status := out.InstanceInformationList[0].PingStatus
+	if status != ssmtypes.PingStatusOnline {
+		check.Status = CheckWarn
+		check.Detail = fmt.Sprintf("SSM agent is %s", status)
+		return check
+	}
+
+	check.Status = CheckOK
+	check.Detail = fmt.Sprintf("SSM agent is online, 'aws ssm start-session --target %s' can be used as a fallback", instanceID)
+	return check
+}
+
+func (d *Doctor) checkTCPProbe(ctx context.Context, instance *types.Instance, opts DoctorOptions) Check {
+	check := Check{Name: "tcp-probe"}
+
+	ip := aws.ToString(instance.PrivateIpAddress)
+	if opts.UsePublicIP {
+		ip = aws.ToString(instance.PublicIpAddress)
+	}
+
+	if ip == "" {
+		check.Status = CheckSkip
+		check.Detail = "no address to probe"
+		return check
+	}
+
+	ctx, cancel := WithTimeout(ctx, opts.ProbeTimeout)
+	defer cancel()
+
+	address := net.JoinHostPort(ip, strconv.Itoa(opts.Port))
+	conn, err := d.dial(ctx, "tcp", address)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("unable to reach %s: %v", address, err)
+		return check
+	}
+	conn.Close()
+
+	check.Status = CheckOK
+	check.Detail = fmt.Sprintf("%s is reachable", address)
+	return check
+}
+
+func skipCheck(check Check, err error) Check {
+	check.Status = CheckSkip
+	check.Detail = fmt.Sprintf("unable to check: %v", err)
+	return check
+}
+
+// allowsPort reports whether the protocol and port range covers the tcp port
+func allowsPort(protocol string, fromPort, toPort *int32, port int) bool {
+	switch protocol {
+	case "-1", "all":
+		return true
+	case "tcp", "6":
+		return fromPort != nil && toPort != nil && int(*fromPort) <= port && port <= int(*toPort)
+	}
+
+	return false
+}
+
+// aclAllowsPort evaluates the network ACL entries in the rule number order for the tcp port from anywhere,
+// it is allowed when an allow rule is evaluated before any deny rule from anywhere
+func aclAllowsPort(entries []types.NetworkAclEntry, egress bool, port int) (bool, string) {
+	rules := make([]types.NetworkAclEntry, 0, len(entries))
+	for _, entry := range entries {
+		if aws.ToBool(entry.Egress) == egress {
+			rules = append(rules, entry)
+		}
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return aws.ToInt32(rules[i].RuleNumber) < aws.ToInt32(rules[j].RuleNumber)
+	})
+
+	for _, rule := range rules {
+		var fromPort, toPort *int32
+		if rule.PortRange != nil {
+			fromPort, toPort = rule.PortRange.From, rule.PortRange.To
+		}
+
+		if !allowsPort(aws.ToString(rule.Protocol), fromPort, toPort, port) {
+			continue
+		}
+
+		ruleNumber := strconv.Itoa(int(aws.ToInt32(rule.RuleNumber)))
+		if rule.RuleAction == types.RuleActionAllow {
+			return true, ruleNumber
+		}
+
+		if aws.ToString(rule.CidrBlock) == "0.0.0.0/0" {
+			return false, ruleNumber
+		}
+	}
+
+	return false, "*"
+}
+
+// defaultRouteTarget get the target of the default route (0.0.0.0/0), if any
+func defaultRouteTarget(routes []types.Route) string {
+	for _, route := range routes {
+		if aws.ToString(route.DestinationCidrBlock) != "0.0.0.0/0" || route.State == types.RouteStateBlackhole {
+			continue
+		}
+
+		for _, target := range []*string{route.GatewayId, route.NatGatewayId, route.TransitGatewayId, route.VpcPeeringConnectionId, route.NetworkInterfaceId} {
+			if aws.ToString(target) != "" {
+				return aws.ToString(target)
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,210 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockDoctorEC2 struct {
+	EC2API
+
+	instance       types.Instance
+	securityGroups []types.SecurityGroup
+	networkACLs    []types.NetworkAcl
+	routeTables    []types.RouteTable
+	images         []types.Image
+	imagesErr      error
+}
+
+func (m *mockDoctorEC2) DescribeInstances(ctx context.Context, input *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	if input.InstanceIds[0] != aws.ToString(m.instance.InstanceId) {
+		return &ec2.DescribeInstancesOutput{}, nil
+	}
+
+	return &ec2.DescribeInstancesOutput{
+		Reservations: []types.Reservation{{Instances: []types.Instance{m.instance}}},
+	}, nil
+}
+
+func (m *mockDoctorEC2) DescribeSecurityGroups(ctx context.Context, input *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error) {
+	return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: m.securityGroups}, nil
+}
+
+func (m *mockDoctorEC2) DescribeNetworkAcls(ctx context.Context, input *ec2.DescribeNetworkAclsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeNetworkAclsOutput, error) {
+	return &ec2.DescribeNetworkAclsOutput{NetworkAcls: m.networkACLs}, nil
+}
+
+func (m *mockDoctorEC2) DescribeRouteTables(ctx context.Context, input *ec2.DescribeRouteTablesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRouteTablesOutput, error) {
+	return &ec2.DescribeRouteTablesOutput{RouteTables: m.routeTables}, nil
+}
+
+func (m *mockDoctorEC2) DescribeImages(ctx context.Context, input *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	if m.imagesErr != nil {
+		return nil, m.imagesErr
+	}
+
+	return &ec2.DescribeImagesOutput{Images: m.images}, nil
+}
+
+type mockSSM struct {
+	SSMAPI
+
+	pingStatus ssmtypes.PingStatus
+}
+
+func (m *mockSSM) DescribeInstanceInformation(ctx context.Context, input *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+	out := &ssm.DescribeInstanceInformationOutput{}
+	if m.pingStatus != "" {
+		out.InstanceInformationList = []ssmtypes.InstanceInformation{{PingStatus: m.pingStatus}}
+	}
+
+	return out, nil
+}
+
+func newMockDoctorEC2() *mockDoctorEC2 {
+	return &mockDoctorEC2{
+		instance: types.Instance{
+			InstanceId:       aws.String("i-12345678abcd"),
+			ImageId:          aws.String("ami-12345678"),
+			PrivateIpAddress: aws.String("10.0.1.10"),
+			SubnetId:         aws.String("subnet-1234"),
+			VpcId:            aws.String("vpc-1234"),
+			State:            &types.InstanceState{Name: types.InstanceStateNameRunning},
+			SecurityGroups:   []types.GroupIdentifier{{GroupId: aws.String("sg-1234")}},
+		},
+		securityGroups: []types.SecurityGroup{
+			{
+				GroupId: aws.String("sg-1234"),
+				IpPermissions: []types.IpPermission{
+					{
+						IpProtocol: aws.String("tcp"),
+						FromPort:   aws.Int32(22),
+						ToPort:     aws.Int32(22),
+						IpRanges:   []types.IpRange{{CidrIp: aws.String("10.0.0.0/8")}},
+					},
+				},
+			},
+		},
+		networkACLs: []types.NetworkAcl{
+			{
+				NetworkAclId: aws.String("acl-1234"),
+				Entries: []types.NetworkAclEntry{
+					{RuleNumber: aws.Int32(100), Protocol: aws.String("-1"), RuleAction: types.RuleActionAllow, CidrBlock: aws.String("0.0.0.0/0"), Egress: aws.Bool(false)},
+					{RuleNumber: aws.Int32(100), Protocol: aws.String("-1"), RuleAction: types.RuleActionAllow, CidrBlock: aws.String("0.0.0.0/0"), Egress: aws.Bool(true)},
+					{RuleNumber: aws.Int32(32767), Protocol: aws.String("-1"), RuleAction: types.RuleActionDeny, CidrBlock: aws.String("0.0.0.0/0"), Egress: aws.Bool(false)},
+					{RuleNumber: aws.Int32(32767), Protocol: aws.String("-1"), RuleAction: types.RuleActionDeny, CidrBlock: aws.String("0.0.0.0/0"), Egress: aws.Bool(true)},
+				},
+			},
+		},
+		routeTables: []types.RouteTable{
+			{
+				RouteTableId: aws.String("rtb-1234"),
+				Routes: []types.Route{
+					{DestinationCidrBlock: aws.String("10.0.0.0/16"), GatewayId: aws.String("local")},
+					{DestinationCidrBlock: aws.String("0.0.0.0/0"), NatGatewayId: aws.String("nat-1234")},
+				},
+			},
+		},
+		images: []types.Image{{Name: aws.String("al2023-ami-2023.5.20240624.0-kernel-6.1-x86_64")}},
+	}
+}
+
+func checkStatuses(checks []Check) map[string]CheckStatus {
+	statuses := make(map[string]CheckStatus)
+	for _, check := range checks {
+		statuses[check.Name] = check.Status
+	}
+	return statuses
+}
+
+func TestDoctorDiagnose(t *testing.T) {
+	opts := DoctorOptions{Port: 22, ProbeTimeout: time.Second}
+	reachable := func(ctx context.Context, network, address string) (net.Conn, error) {
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+	unreachable := func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, errors.New("i/o timeout")
+	}
+
+	t.Run("all checks are passed", func(t *testing.T) {
+		doctor := NewDoctor(newMockDoctorEC2(), &mockSSM{pingStatus: ssmtypes.PingStatusOnline})
+		doctor.dial = reachable
+
+		checks, err := doctor.Diagnose(context.Background(), "i-12345678abcd", opts)
+		assert.Nil(t, err)
+		assert.Len(t, checks, 8)
+		for _, check := range checks {
+			assert.Equal(t, CheckOK, check.Status, "%s: %s", check.Name, check.Detail)
+		}
+	})
+
+	t.Run("report the likely causes", func(t *testing.T) {
+		client := newMockDoctorEC2()
+		client.securityGroups[0].IpPermissions[0].FromPort = aws.Int32(443)
+		client.securityGroups[0].IpPermissions[0].ToPort = aws.Int32(443)
+		client.networkACLs[0].Entries = append(client.networkACLs[0].Entries, types.NetworkAclEntry{
+			RuleNumber: aws.Int32(10), Protocol: aws.String("6"), RuleAction: types.RuleActionDeny, CidrBlock: aws.String("0.0.0.0/0"), Egress: aws.Bool(false),
+			PortRange: &types.PortRange{From: aws.Int32(22), To: aws.Int32(22)},
+		})
+		client.images[0].Name = aws.String("RHEL-9.4.0_HVM-20240605-x86_64")
+
+		doctor := NewDoctor(client, &mockSSM{})
+		doctor.dial = unreachable
+
+		checks, err := doctor.Diagnose(context.Background(), "i-12345678abcd", DoctorOptions{Port: 22, UsePublicIP: true})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]CheckStatus{
+			"instance-state":       CheckOK,
+			"address":              CheckFail,
+			"security-groups":      CheckFail,
+			"network-acl":          CheckFail,
+			"route-table":          CheckFail,
+			"ec2-instance-connect": CheckWarn,
+			"ssm":                  CheckWarn,
+			"tcp-probe":            CheckSkip,
+		}, checkStatuses(checks))
+	})
+
+	t.Run("instance connect tag takes precedence over the AMI", func(t *testing.T) {
+		client := newMockDoctorEC2()
+		client.instance.Tags = []types.Tag{{Key: aws.String(EC2InstanceConnectTag), Value: aws.String("false")}}
+
+		doctor := NewDoctor(client, nil)
+		doctor.dial = reachable
+
+		checks, err := doctor.Diagnose(context.Background(), "i-12345678abcd", opts)
+		assert.Nil(t, err)
+		assert.Equal(t, CheckFail, checkStatuses(checks)["ec2-instance-connect"])
+		assert.Equal(t, CheckSkip, checkStatuses(checks)["ssm"])
+	})
+
+	t.Run("skip the check without permission", func(t *testing.T) {
+		client := newMockDoctorEC2()
+		client.imagesErr = &smithy.GenericAPIError{Code: "UnauthorizedOperation", Message: "You are not authorized."}
+
+		doctor := NewDoctor(client, nil)
+		doctor.dial = reachable
+
+		checks, err := doctor.Diagnose(context.Background(), "i-12345678abcd", opts)
+		assert.Nil(t, err)
+		assert.Equal(t, CheckSkip, checkStatuses(checks)["ec2-instance-connect"])
+	})
+
+	t.Run("instance not found", func(t *testing.T) {
+		_, err := NewDoctor(newMockDoctorEC2(), nil).Diagnose(context.Background(), "i-00000000", opts)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,77 @@
+package aws
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"awssh/internal/errdefs"
+)
+
+// ErrCodeRequestError is the pseudo error code of a failure to send the request, e.g. network unreachable
+const ErrCodeRequestError = "RequestError"
+
+// errorKinds maps the AWS error codes to the awssh error kinds
+var errorKinds = map[string]error{
+	// EC2 Instance Connect
+	"AuthException":                errdefs.ErrAuthDenied,
+	"InvalidArgsException":         errdefs.ErrInvalidArgs,
+	"ThrottlingException":          errdefs.ErrThrottled,
+	"EC2InstanceNotFoundException": errdefs.ErrNotFound,
+
+	// EC2 Serial Console
+	"SerialConsoleAccessDisabledException":       errdefs.ErrAuthDenied,
+	"SerialConsoleSessionLimitExceededException": errdefs.ErrThrottled,
+	"SerialConsoleSessionUnavailableException":   errdefs.ErrNetworkUnreachable,
+	"EC2InstanceTypeInvalidException":            errdefs.ErrInvalidArgs,
+
+	// EC2
+	"InvalidInstanceID.NotFound":  errdefs.ErrNotFound,
+	"InvalidInstanceID.Malformed": errdefs.ErrInvalidArgs,
+	"InvalidParameterValue":       errdefs.ErrInvalidArgs,
+	"UnauthorizedOperation":       errdefs.ErrAuthDenied,
+	"AuthFailure":                 errdefs.ErrAuthDenied,
+	"RequestLimitExceeded":        errdefs.ErrThrottled,
+
+	// Common
+	"AccessDenied":          errdefs.ErrAuthDenied,
+	"AccessDeniedException": errdefs.ErrAuthDenied,
+	"ExpiredToken":          errdefs.ErrAuthDenied,
+	"UnauthorizedException": errdefs.ErrAuthDenied,
+	"Throttling":            errdefs.ErrThrottled,
+
+	ErrCodeRequestError: errdefs.ErrNetworkUnreachable,
+}
+
+// errorCode get the AWS error code of the error, if any
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+
+	var sendErr *smithyhttp.RequestSendError
+	if errors.As(err, &sendErr) {
+		return ErrCodeRequestError
+	}
+
+	return ""
+}
+
+// wrapError wraps an AWS error with the matching awssh error kind
+func wrapError(err error, format string, args ...interface{}) error {
+	kind := errorKinds[errorCode(err)]
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		kind = errdefs.FromContext(err)
+	}
+
+	// the SSO session may expire after the credentials are checked at start, e.g. during a long wrapped command
+	if IsSSOTokenError(err) {
+		return errdefs.Wrap(errdefs.ErrAuthDenied, err, format+", the SSO session is expired, run 'awssh login' to login", args...)
+	}
+
+	return errdefs.Wrap(kind, err, format, args...)
+}
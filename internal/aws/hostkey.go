@@ -0,0 +1,106 @@
+package aws
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+
+	"awssh/config"
+	"awssh/internal/logging"
+)
+
+const (
+	// HostKeyTagPrefix is the EC2 tag key prefix used to publish the ssh host keys at boot,
+	// e.g. "awssh:host-key:ed25519" = "ssh-ed25519 AAAAC3Nza..."
+	HostKeyTagPrefix = "awssh:host-key:"
+
+	consoleHostKeysBegin = "-----BEGIN SSH HOST KEY KEYS-----"
+	consoleHostKeysEnd   = "-----END SSH HOST KEY KEYS-----"
+)
+
+// GetHostKeys get the ssh host keys of the EC2 instance
+// The host keys are parsed from the EC2 console output as printed by cloud-init at boot, as it comes from the instance itself.
+// The instance tags (see HostKeyTagPrefix) can be changed by anyone allowed to tag the instance,
+// so they are only used when the console output has no host keys and trusting them is opted in
+func (p Provider) GetHostKeys(ctx context.Context, instance *Instance) ([]string, error) {
+	keys, err := p.getConsoleHostKeys(ctx, instance)
+	if len(keys) > 0 || !config.GetHostKeyTags() {
+		return keys, err
+	}
+
+	tagKeys := make([]string, 0)
+	for k, v := range instance.Tags {
+		if strings.HasPrefix(k, HostKeyTagPrefix) {
+			tagKeys = append(tagKeys, v)
+		}
+	}
+
+	if len(tagKeys) == 0 {
+		return keys, err
+	}
+
+	logging.Logger().Debugf("awssh: found %d host keys from EC2 instance tags '%s' (%s)", len(tagKeys), instance.Name, instance.InstanceID)
+	return tagKeys, nil
+}
+
+func (p Provider) getConsoleHostKeys(ctx context.Context, instance *Instance) ([]string, error) {
+	input := &ec2.GetConsoleOutputInput{
+		InstanceId: aws.String(instance.InstanceID),
+	}
+
+	out, err := p.Client.GetConsoleOutput(ctx, input)
+	if err != nil {
+		return nil, wrapError(err, "unable to get EC2 console output")
+	}
+
+	if out == nil || out.Output == nil {
+		return nil, nil
+	}
+
+	output, err := base64.StdEncoding.DecodeString(*out.Output)
+	if err != nil {
+		return nil, fmt.Errorf("awssh: unable to decode EC2 console output: (%v)", err)
+	}
+
+	keys := ParseConsoleHostKeys(string(output))
+	logging.Logger().Debugf("awssh: found %d host keys from EC2 console output '%s' (%s)", len(keys), instance.Name, instance.InstanceID)
+	return keys, nil
+}
+
+// ParseConsoleHostKeys parse the ssh host keys block from the EC2 console output
+func ParseConsoleHostKeys(output string) []string {
+	keys := make([]string, 0)
+	inBlock := false
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case strings.HasSuffix(line, consoleHostKeysBegin):
+			inBlock = true
+			keys = keys[:0]
+		case strings.HasSuffix(line, consoleHostKeysEnd):
+			inBlock = false
+		case inBlock:
+			if key := hostKeyFromLine(line); key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys
+}
+
+// hostKeyFromLine strips any console prefix (e.g. kernel timestamp) from the line
+func hostKeyFromLine(line string) string {
+	for _, prefix := range []string{"ssh-", "ecdsa-"} {
+		if idx := strings.Index(line, prefix); idx >= 0 {
+			return line[idx:]
+		}
+	}
+	return ""
+}
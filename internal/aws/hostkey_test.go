@@ -0,0 +1,81 @@
+package aws_test
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"awssh/config"
+	. "awssh/internal/aws"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+const consoleOutput = `[    5.123456] cloud-init[1234]: Cloud-init v. 19.3 running 'modules:final'
+-----BEGIN SSH HOST KEY FINGERPRINTS-----
+256 SHA256:LGYZ2WMCYjRUEm/9bOS4Yr8Tqer6aQnfZRdNeaM6CKY no comment (ECDSA)
+-----END SSH HOST KEY FINGERPRINTS-----
+-----BEGIN SSH HOST KEY KEYS-----
+ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAI
+[   10.654321] ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOza
+-----END SSH HOST KEY KEYS-----
+`
+
+func TestParseConsoleHostKeys(t *testing.T) {
+	keys := ParseConsoleHostKeys(consoleOutput)
+	assert.Equal(t, []string{
+		"ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAI",
+		"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOza",
+	}, keys)
+
+	assert.Empty(t, ParseConsoleHostKeys("no host keys printed"))
+}
+
+func TestGetHostKeys(t *testing.T) {
+	taggedInstance := &Instance{
+		InstanceID: "i-12345678abcd",
+		Tags: map[string]string{
+			"Name":                   "lalala",
+			"awssh:host-key:ed25519": "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPlanted",
+		},
+	}
+	consoleProvider := NewProvider(&mockEC2{
+		expectedConsoleOutput: &ec2.GetConsoleOutputOutput{
+			InstanceId: aws.String("i-12345678abcd"),
+			Output:     aws.String(base64.StdEncoding.EncodeToString([]byte(consoleOutput))),
+		},
+	})
+
+	t.Run("host keys from console output", func(t *testing.T) {
+		keys, err := consoleProvider.GetHostKeys(context.Background(), &Instance{InstanceID: "i-12345678abcd"})
+		assert.Nil(t, err)
+		assert.Len(t, keys, 2)
+	})
+
+	t.Run("instance tags are not trusted by default", func(t *testing.T) {
+		keys, err := NewProvider(&mockEC2{}).GetHostKeys(context.Background(), taggedInstance)
+		assert.Nil(t, err)
+		assert.Empty(t, keys)
+	})
+
+	flagSet := pflag.NewFlagSet("awssh", pflag.ContinueOnError)
+	config.AddEC2AccessFlags(flagSet)
+	defer flagSet.Set("host-key-tags", "false") // nolint: errcheck
+	assert.Nil(t, flagSet.Set("host-key-tags", "true"))
+
+	t.Run("console output is preferred over instance tags", func(t *testing.T) {
+		keys, err := consoleProvider.GetHostKeys(context.Background(), taggedInstance)
+		assert.Nil(t, err)
+		assert.Len(t, keys, 2)
+		assert.NotContains(t, keys, "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPlanted")
+	})
+
+	t.Run("host keys from instance tags", func(t *testing.T) {
+		keys, err := NewProvider(&mockEC2{}).GetHostKeys(context.Background(), taggedInstance)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPlanted"}, keys)
+	})
+}
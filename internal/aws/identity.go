@@ -0,0 +1,28 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Identity represent the AWS identity used by the credentials
+type Identity struct {
+	Account string
+	ARN     string
+	UserID  string
+}
+
+// GetCallerIdentity get the AWS identity of the credentials from STS
+func GetCallerIdentity(ctx context.Context, client STSAPI) (*Identity, error) {
+	out, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, wrapError(err, "unable to get caller identity")
+	}
+
+	return &Identity{
+		Account: *out.Account,
+		ARN:     *out.Arn,
+		UserID:  *out.UserId,
+	}, nil
+}
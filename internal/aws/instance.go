@@ -1,18 +1,23 @@
 package aws
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os/exec"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
-	"github.com/aws/aws-sdk-go/service/ec2instanceconnect/ec2instanceconnectiface"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
 	"golang.org/x/crypto/ssh/agent"
 
 	"awssh/config"
+	"awssh/internal/audit"
+	"awssh/internal/errdefs"
+	"awssh/internal/keypush"
 	"awssh/internal/logging"
 	"awssh/internal/ssh"
 )
@@ -24,99 +29,242 @@ type Instance struct {
 	PrivateIP        string
 	PublicIP         string
 	AvailabilityZone string
+	InstanceType     string
+	Tags             map[string]string
+	HostKeys         []string
+	Platform         string
+	KeyName          string
+
+	// ASGName, EKSCluster, EKSNodegroup and ECSCluster are derived from the well-known tags
+	ASGName      string
+	EKSCluster   string
+	EKSNodegroup string
+	ECSCluster   string
 }
 
-type ShellCommandFunc func(name string, args ...string) *exec.Cmd
+// TagASGName is the tag of the auto-scaling group members, set by the Auto Scaling service
+const TagASGName = "aws:autoscaling:groupName"
+
+// The well-known tags of the EKS nodes and ECS container instances, the first tag found is used
+var (
+	eksClusterTags   = []string{"eks:cluster-name", "alpha.eksctl.io/cluster-name"}
+	eksNodegroupTags = []string{"eks:nodegroup-name", "alpha.eksctl.io/nodegroup-name"}
+	ecsClusterTags   = []string{"aws:ecs:clusterName", "ecs:cluster-name"}
+)
+
+// eksClusterTagPrefix is the prefix of the 'kubernetes.io/cluster/<name>' tag of the self-managed EKS nodes
+const eksClusterTagPrefix = "kubernetes.io/cluster/"
+
+// SSHPublicKeyValidity is how long the ssh public key pushed with EC2 Instance Connect is valid
+const SSHPublicKeyValidity = 60 * time.Second
+
+// keyPushMargin is the safety margin before the pushed key expires, the key is pushed again within it
+const keyPushMargin = 15 * time.Second
+
+// Transport used to establish an ssh connection to the EC2 instance
+const (
+	TransportPrivateIP = "private-ip"
+	TransportPublicIP  = "public-ip"
+
+	TransportSerialConsole = "serial-console"
+)
+
+type ShellCommandFunc func(ctx context.Context, name string, args ...string) *exec.Cmd
 
 // NewEC2Instance creates a new EC2Instance from aws ec2 instance source
-func NewInstance(instance *ec2.Instance) *Instance {
+func NewInstance(instance *types.Instance) *Instance {
 	ec2InstanceName := GetTagValue("Name", instance)
 
 	if ec2InstanceName == "" {
-		ec2InstanceName = fmt.Sprintf("ec2:noname:%s", *instance.InstanceId)
+		ec2InstanceName = fmt.Sprintf("ec2:noname:%s", aws.ToString(instance.InstanceId))
 	}
 
-	var publicIPAddr string
+	// a pending or terminated instance may have neither a network interface nor a placement
+	var availabilityZone string
+	if instance.Placement != nil {
+		availabilityZone = aws.ToString(instance.Placement.AvailabilityZone)
+	}
 
-	if instance.PublicIpAddress == nil {
-		publicIPAddr = ""
-	} else {
-		publicIPAddr = *instance.PublicIpAddress
+	tags := make(map[string]string)
+	for _, tag := range instance.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
 	}
 
 	return &Instance{
 		Name:             ec2InstanceName,
-		InstanceID:       *instance.InstanceId,
-		PrivateIP:        *instance.PrivateIpAddress,
-		PublicIP:         publicIPAddr,
-		AvailabilityZone: *instance.Placement.AvailabilityZone,
+		InstanceID:       aws.ToString(instance.InstanceId),
+		PrivateIP:        aws.ToString(instance.PrivateIpAddress),
+		PublicIP:         aws.ToString(instance.PublicIpAddress),
+		AvailabilityZone: availabilityZone,
+		InstanceType:     string(instance.InstanceType),
+		Tags:             tags,
+		Platform:         string(instance.Platform),
+		KeyName:          aws.ToString(instance.KeyName),
+		ASGName:          tags[TagASGName],
+		EKSCluster:       eksCluster(tags),
+		EKSNodegroup:     firstTagValue(tags, eksNodegroupTags),
+		ECSCluster:       firstTagValue(tags, ecsClusterTags),
+	}
+}
+
+// IsWindows reports whether the instance is a Windows instance, which is accessed with RDP instead of ssh
+func (e *Instance) IsWindows() bool {
+	return strings.EqualFold(e.Platform, string(types.PlatformValuesWindows))
+}
+
+// Cluster get the EKS cluster and nodegroup or the ECS cluster of the instance,
+// e.g. 'eks:production/workers' or 'ecs:production'. It is empty when the instance is neither
+func (e *Instance) Cluster() string {
+	switch {
+	case e.EKSCluster != "" && e.EKSNodegroup != "":
+		return fmt.Sprintf("eks:%s/%s", e.EKSCluster, e.EKSNodegroup)
+	case e.EKSCluster != "":
+		return "eks:" + e.EKSCluster
+	case e.ECSCluster != "":
+		return "ecs:" + e.ECSCluster
 	}
+
+	return ""
+}
+
+// SortByASG sorts the instances grouped by the auto-scaling group,
+// the instances without auto-scaling group are placed last. The order within a group is kept
+func SortByASG(instances []*Instance) {
+	sort.SliceStable(instances, func(i, j int) bool {
+		a, b := instances[i].ASGName, instances[j].ASGName
+		if a == "" || b == "" {
+			return a != "" && b == ""
+		}
+		return a < b
+	})
+}
+
+func eksCluster(tags map[string]string) string {
+	if cluster := firstTagValue(tags, eksClusterTags); cluster != "" {
+		return cluster
+	}
+
+	for key, value := range tags {
+		if strings.HasPrefix(key, eksClusterTagPrefix) && value == "owned" {
+			return strings.TrimPrefix(key, eksClusterTagPrefix)
+		}
+	}
+
+	return ""
+}
+
+func firstTagValue(tags map[string]string, keys []string) string {
+	for _, key := range keys {
+		if value := tags[key]; value != "" {
+			return value
+		}
+	}
+
+	return ""
 }
 
 // sendSSHPublicKey is an extend method to do ec2-instance-connect task
 // for sending SSH Public Key to the AWS API Server
-func (e *Instance) sendSSHPublicKey(client ec2instanceconnectiface.EC2InstanceConnectAPI, publicKey string) (err error) {
+func (e *Instance) sendSSHPublicKey(ctx context.Context, client EC2InstanceConnectAPI, publicKey, osUser string) (err error) {
 	input := &ec2instanceconnect.SendSSHPublicKeyInput{
 		InstanceId:       aws.String(e.InstanceID),
 		SSHPublicKey:     aws.String(publicKey),
-		InstanceOSUser:   aws.String(config.GetSSHUsername()),
+		InstanceOSUser:   aws.String(osUser),
 		AvailabilityZone: aws.String(e.AvailabilityZone),
 	}
 
 	logging.Logger().Debugf("Sending SSH Public Key for EC2 instance '%s' (%s)", e.Name, e.InstanceID)
 
-	if _, err := client.SendSSHPublicKey(input); err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case ec2instanceconnect.ErrCodeAuthException:
-				return fmt.Errorf("%s: %v", ec2instanceconnect.ErrCodeAuthException, aerr.Error())
-			case ec2instanceconnect.ErrCodeInvalidArgsException:
-				return fmt.Errorf("%s: %v", ec2instanceconnect.ErrCodeInvalidArgsException, aerr.Error())
-			case ec2instanceconnect.ErrCodeServiceException:
-				return fmt.Errorf("%s: %v", ec2instanceconnect.ErrCodeServiceException, aerr.Error())
-			case ec2instanceconnect.ErrCodeThrottlingException:
-				return fmt.Errorf("%s: %v", ec2instanceconnect.ErrCodeThrottlingException, aerr.Error())
-			case ec2instanceconnect.ErrCodeEC2InstanceNotFoundException:
-				return fmt.Errorf("%s: %v", ec2instanceconnect.ErrCodeEC2InstanceNotFoundException, aerr.Error())
-			default:
-				return fmt.Errorf(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			return fmt.Errorf(err.Error())
-		}
+	if _, err := client.SendSSHPublicKey(ctx, input); err != nil {
+		return wrapError(err, "unable to send ssh public key to EC2 instance '%s' (%s)", e.Name, e.InstanceID)
 	}
 
 	return nil
+}
 
+// pushSSHPublicKey sends the ssh public key of the session and audits it, unless the key is pushed to the instance
+// for the OS user within its validity minus a safety margin, as recorded in the key push cache.
+// Only the keys held by ssh-agent are skipped across the awssh runs, as the temporary ssh keypair is a new key on every run
+func (e *Instance) pushSSHPublicKey(ctx context.Context, client EC2InstanceConnectAPI, sshSession *ssh.Session, osUser, transport, address string) error {
+	var pushCache *keypush.Cache
+
+	if config.GetKeyPushCache() {
+		pushCache = keypush.NewCache(config.GetKeyPushCacheFile(), SSHPublicKeyValidity-keyPushMargin)
+
+		if !config.GetForcePush() && pushCache.Valid(e.InstanceID, osUser, sshSession.Fingerprint) {
+			logging.Logger().Debugf("awssh: skip sending SSH Public Key (%s) for EC2 instance '%s' (%s), it is still valid", sshSession.Fingerprint, e.Name, e.InstanceID)
+			return nil
+		}
+	}
+
+	err := e.sendSSHPublicKey(ctx, client, sshSession.PublicKey, osUser)
+	e.audit(audit.Record{
+		Event:          audit.EventSendSSHPublicKey,
+		OSUser:         osUser,
+		KeyFingerprint: sshSession.Fingerprint,
+		Transport:      transport,
+		Address:        address,
+	}, err)
+	if err != nil {
+		return err
+	}
+
+	if pushCache != nil {
+		if err := pushCache.Record(e.InstanceID, osUser, sshSession.Fingerprint); err != nil {
+			logging.Logger().Warnf("awssh: unable to record the pushed SSH Public Key: %v", err)
+		}
+	}
+
+	return nil
 }
 
 // Connect used to establish an ssh connection from the EC2Instance
-// following with the use of public ip
-func (e *Instance) Connect(sshAgent agent.ExtendedAgent, client ec2instanceconnectiface.EC2InstanceConnectAPI, cmdFn ShellCommandFunc, usePublicIP bool) (err error) {
+// following with the use of public ip.
+// The ssh public key is sent within the connect timeout, while the ssh process
+// lives until the session ends or the context is cancelled
+func (e *Instance) Connect(ctx context.Context, sshAgent agent.ExtendedAgent, client EC2InstanceConnectAPI, cmdFn ShellCommandFunc, usePublicIP bool) (err error) {
 	logging.Logger().Debugf("awssh: select EC2 instance '%s' (%s)", e.Name, e.InstanceID)
 
-	var ipAddr string
-
-	sshSession, err := ssh.NewSession(sshAgent, e.InstanceID)
+	ipAddr, transport, err := e.Address(usePublicIP)
 	if err != nil {
-		return
+		return err
 	}
 
-	if err := e.sendSSHPublicKey(client, sshSession.PublicKey); err != nil {
+	sshOpts, err := ssh.Options(config.GetSSHOpts(), config.GetSSHOpt())
+	if err != nil {
 		return err
 	}
 
-	ipAddr = e.PrivateIP
+	var (
+		controlPath   string
+		muxOpts       []string
+		masterRunning bool
+		fingerprint   string
+	)
 
-	if usePublicIP {
-		if e.PublicIP == "" {
-			return fmt.Errorf("awssh: could not find public IP for EC2 instance target '%s' (%s)", e.Name, e.InstanceID)
+	if config.GetMultiplex() {
+		controlPath, err = ssh.ControlPath(config.GetRuntimeDir(), e.InstanceID, config.GetSSHUsername(), config.GetSSHPort())
+		if err != nil {
+			return err
 		}
 
-		logging.Logger().Debugf("awssh: use public IP to connect to the EC2 instance target '%s' (%s): %s", e.Name, e.InstanceID, e.PublicIP)
-		ipAddr = e.PublicIP
+		muxOpts = ssh.MuxOptions(controlPath, config.GetControlPersist())
+		// the master is asked right before connecting, as the socket may be left behind by an exiting master
+		masterRunning = ssh.MasterRunning(controlPath) && cmdFn(ctx, "ssh", ssh.CheckArgs(controlPath, ipAddr)...).Run() == nil
+	}
+
+	if masterRunning {
+		// the connection is multiplexed through the authenticated master, there is no key to send
+		logging.Logger().Debugf("awssh: reuse the ssh ControlMaster of EC2 instance '%s' (%s)", e.Name, e.InstanceID)
+	} else {
+		sshSession, err := e.pushSessionKey(ctx, sshAgent, client, transport, ipAddr)
+		if err != nil {
+			return err
+		}
+
+		// the temporary ssh keypair lives as long as the ssh session
+		defer sshSession.Close() // nolint: errcheck
+		fingerprint = sshSession.Fingerprint
 	}
 
 	logging.Logger().Debugf("awssh: establish an SSH connection to the EC2 instance target '%s' (%s)", e.Name, e.InstanceID)
@@ -126,12 +274,252 @@ func (e *Instance) Connect(sshAgent agent.ExtendedAgent, client ec2instanceconne
 		config.GetSSHUsername(),
 		"-p",
 		config.GetSSHPort(),
-		ipAddr,
 	}
 
-	sshOpts := strings.Split(config.GetSSHOpts(), " ")
+	// ssh keeps the first value of an option, so the host key verification is placed before the user ssh options
+	if config.GetStrictHostKeyChecking() {
+		hostKeyOpts, err := e.hostKeyOpts()
+		if err != nil {
+			return err
+		}
+		sshArgs = append(sshArgs, hostKeyOpts...)
+	}
+
 	sshArgs = append(sshArgs, sshOpts...)
+	sshArgs = append(sshArgs, muxOpts...)
+
+	command := remoteCommand(config.GetRemoteCommand(), config.GetTmux())
+	if command != "" {
+		// ssh does not allocate a tty for a remote command, so it is forced to keep the session interactive
+		sshArgs = append(sshArgs, "-t")
+	}
+
+	// the options are placed before the host, as anything after the host is the remote command
+	sshArgs = append(sshArgs, ipAddr)
+	if command != "" {
+		sshArgs = append(sshArgs, command)
+	}
+
+	err = e.runSSH(ctx, cmdFn, sshArgs, audit.Record{
+		KeyFingerprint: fingerprint,
+		Transport:      transport,
+		Address:        ipAddr,
+	})
+	// a remote command is never run again, as its exit status 255 is not told apart from ssh failing
+	// and the command may not be idempotent, only the interactive shell is opened again
+	if !masterRunning || command != "" || !isSSHConnectionError(err) || ssh.MasterRunning(controlPath) {
+		return err
+	}
+
+	// the master exited after it was checked, ssh started a new master without any key sent to the instance
+	logging.Logger().Warnf("awssh: the ssh ControlMaster of EC2 instance '%s' (%s) is gone, connect again with a new ssh public key", e.Name, e.InstanceID)
+
+	sshSession, err := e.pushSessionKey(ctx, sshAgent, client, transport, ipAddr)
+	if err != nil {
+		return err
+	}
+	defer sshSession.Close() // nolint: errcheck
+
+	return e.runSSH(ctx, cmdFn, sshArgs, audit.Record{
+		KeyFingerprint: sshSession.Fingerprint,
+		Transport:      transport,
+		Address:        ipAddr,
+	})
+}
+
+// pushSessionKey creates the ssh session of the instance and sends its public key within the connect timeout,
+// the caller closes the session once the ssh connection ends
+func (e *Instance) pushSessionKey(ctx context.Context, sshAgent agent.ExtendedAgent, client EC2InstanceConnectAPI, transport, ipAddr string) (*ssh.Session, error) {
+	sshSession, err := ssh.NewSession(sshAgent, e.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	connectCtx, cancel := WithTimeout(ctx, config.GetTimeout())
+	defer cancel()
+
+	if err = e.pushSSHPublicKey(connectCtx, client, sshSession, config.GetSSHUsername(), transport, ipAddr); err != nil {
+		sshSession.Close() // nolint: errcheck
+		return nil, err
+	}
+
+	return sshSession, nil
+}
+
+// isSSHConnectionError tells if ssh failed on its own, ssh exits with 255 when the connection or the authentication fails
+func isSSHConnectionError(err error) bool {
+	var exitErr *errdefs.ExitError
+	return errors.As(err, &exitErr) && exitErr.Code == 255
+}
+
+// PushSSHPublicKey sends the ssh public key of the session for the OS user within the connect timeout,
+// then returns the IP address to connect to. The key is valid for 60 seconds, it is meant to be used right away
+func (e *Instance) PushSSHPublicKey(ctx context.Context, client EC2InstanceConnectAPI, sshSession *ssh.Session, osUser string, usePublicIP bool) (string, error) {
+	ipAddr, transport, err := e.Address(usePublicIP)
+	if err != nil {
+		return "", err
+	}
+
+	connectCtx, cancel := WithTimeout(ctx, config.GetTimeout())
+	defer cancel()
+
+	if err = e.pushSSHPublicKey(connectCtx, client, sshSession, osUser, transport, ipAddr); err != nil {
+		return "", err
+	}
+
+	return ipAddr, nil
+}
+
+// Address get the IP address and the transport to connect to the instance, either its private or public IP
+func (e *Instance) Address(usePublicIP bool) (ipAddr, transport string, err error) {
+	if !usePublicIP {
+		if e.PrivateIP == "" {
+			return "", "", errdefs.New(errdefs.ErrNotFound, "could not find private IP for EC2 instance target '%s' (%s)", e.Name, e.InstanceID)
+		}
+		return e.PrivateIP, TransportPrivateIP, nil
+	}
+
+	if e.PublicIP == "" {
+		return "", "", errdefs.New(errdefs.ErrNotFound, "could not find public IP for EC2 instance target '%s' (%s)", e.Name, e.InstanceID)
+	}
+
+	logging.Logger().Debugf("awssh: use public IP to connect to the EC2 instance target '%s' (%s): %s", e.Name, e.InstanceID, e.PublicIP)
+	return e.PublicIP, TransportPublicIP, nil
+}
+
+// runSSH runs the ssh process until the session ends or the context is cancelled,
+// the start and the end of the session are audited with the session record
+func (e *Instance) runSSH(ctx context.Context, cmdFn ShellCommandFunc, sshArgs []string, sessionRecord audit.Record) error {
+	sessionRecord.Event = audit.EventSessionStart
+	e.audit(sessionRecord, nil)
 
 	logging.Logger().Infof("awssh: running command: ssh %s\n", strings.Join(sshArgs[:], " "))
-	return cmdFn("ssh", sshArgs...).Run()
+
+	start := time.Now()
+	err := cmdFn(ctx, "ssh", sshArgs...).Run()
+
+	sessionRecord.Event = audit.EventSessionEnd
+	sessionRecord.Duration = time.Since(start).Seconds()
+	sessionRecord.ExitStatus = audit.ExitStatus(exitStatus(err))
+	e.audit(sessionRecord, err)
+
+	if ctx.Err() != nil {
+		return errdefs.Wrap(errdefs.FromContext(ctx.Err()), ctx.Err(), "ssh session to EC2 instance '%s' (%s) is interrupted", e.Name, e.InstanceID)
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return &errdefs.ExitError{Code: exitErr.ExitCode()}
+	}
+	if err != nil {
+		return errdefs.Wrap(errdefs.ErrSSHFailure, err, "unable to run ssh")
+	}
+
+	return nil
+}
+
+// remoteCommand builds the command run on the EC2 instance after login.
+// The command is followed by a login shell, so the session stays interactive once the command is done.
+// With a tmux session, the session is attached or created running the command
+func remoteCommand(command, tmuxSession string) string {
+	if command != "" {
+		command += `; exec "$SHELL" -l`
+	}
+
+	if tmuxSession == "" {
+		return command
+	}
+
+	tmux := "tmux new-session -A -s " + shellQuote(tmuxSession)
+	if command != "" {
+		tmux += " " + shellQuote(command)
+	}
+
+	return tmux
+}
+
+// shellQuote quotes the string as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// audit emits an audit record of the EC2 instance
+func (e *Instance) audit(record audit.Record, err error) {
+	record.InstanceID = e.InstanceID
+	record.InstanceName = e.Name
+	if record.OSUser == "" {
+		record.OSUser = config.GetSSHUsername()
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	audit.Log(record)
+}
+
+// exitStatus get the exit status of a command from its error
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+
+	return -1
+}
+
+// hostKeyOpts records the EC2 instance host keys into the awssh-managed known_hosts file
+// and returns the ssh options to verify the host keys against it
+func (e *Instance) hostKeyOpts() ([]string, error) {
+	knownHostsFile, strictMode, err := e.RecordHostKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{
+		"-o", "StrictHostKeyChecking=" + strictMode,
+		"-o", "UserKnownHostsFile=" + knownHostsFile,
+		"-o", "HostKeyAlias=" + e.InstanceID,
+	}, nil
+}
+
+// RecordHostKeys records the EC2 instance host keys keyed by the instance-id into the awssh-managed known_hosts file,
+// then returns the file and the ssh StrictHostKeyChecking mode to verify the host keys against it.
+// The changed host keys are refused unless accepting them is opted in, and
+// when the instance has no published host keys, it falls back to trust-on-first-use
+func (e *Instance) RecordHostKeys() (knownHostsFile, strictMode string, err error) {
+	knownHosts, err := ssh.NewKnownHosts(config.GetKnownHostsFile())
+	if err != nil {
+		return "", "", err
+	}
+
+	strictMode = "yes"
+
+	if len(e.HostKeys) > 0 {
+		changed, err := knownHosts.Changed(e.InstanceID, e.HostKeys)
+		if err != nil {
+			return "", "", err
+		}
+
+		if changed && !config.GetAcceptChangedHostKey() {
+			return "", "", errdefs.New(errdefs.ErrSSHFailure, "the host keys of EC2 instance '%s' (%s) have changed from the keys recorded in %s, "+
+				"someone could be eavesdropping on you right now (man-in-the-middle attack)! "+
+				"Run with --accept-changed-host-key to replace them once the change is verified", e.Name, e.InstanceID, knownHosts.Path)
+		}
+
+		if err := knownHosts.Update(e.InstanceID, e.HostKeys); err != nil {
+			return "", "", err
+		}
+
+		if changed {
+			logging.Logger().Warnf("awssh: WARNING! THE HOST KEYS OF EC2 INSTANCE '%s' (%s) HAVE CHANGED! "+
+				"The recorded host keys in %s are replaced with the keys published by the instance, as --accept-changed-host-key is given", e.Name, e.InstanceID, knownHosts.Path)
+		}
+	} else {
+		logging.Logger().Warnf("awssh: no published host keys found for EC2 instance '%s' (%s), trusting the host key on first use", e.Name, e.InstanceID)
+		strictMode = "accept-new"
+	}
+
+	return knownHosts.Path, strictMode, nil
 }
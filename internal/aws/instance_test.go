@@ -2,33 +2,49 @@ package aws
 
 import (
 	"awssh/config"
+	"awssh/internal/errdefs"
 	"awssh/internal/logging"
+	sshsession "awssh/internal/ssh"
+	"context"
+	"errors"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
-	"github.com/aws/aws-sdk-go/service/ec2instanceconnect/ec2instanceconnectiface"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect/types"
+	"github.com/aws/smithy-go"
+	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
 
 type mockEC2InstanceConnectAPI struct {
-	ec2instanceconnectiface.EC2InstanceConnectAPI
+	EC2InstanceConnectAPI
 
 	expectedInput *ec2instanceconnect.SendSSHPublicKeyInput
+	failures      []error
+	calls         int
 }
 
-func (m mockEC2InstanceConnectAPI) SendSSHPublicKey(input *ec2instanceconnect.SendSSHPublicKeyInput) (*ec2instanceconnect.SendSSHPublicKeyOutput, error) {
+func (m *mockEC2InstanceConnectAPI) SendSSHPublicKey(ctx context.Context, input *ec2instanceconnect.SendSSHPublicKeyInput, optFns ...func(*ec2instanceconnect.Options)) (*ec2instanceconnect.SendSSHPublicKeyOutput, error) {
+	m.calls++
+	if m.calls <= len(m.failures) {
+		return nil, m.failures[m.calls-1]
+	}
 
-	if *(m.expectedInput.InstanceId) != *(input.InstanceId) {
-		return nil, awserr.New(ec2instanceconnect.ErrCodeInvalidArgsException, "mismatch instance-id", nil)
+	if m.expectedInput != nil && *(m.expectedInput.InstanceId) != *(input.InstanceId) {
+		return nil, &types.InvalidArgsException{Message: aws.String("mismatch instance-id")}
 	}
 
-	return nil, nil
+	return &ec2instanceconnect.SendSSHPublicKeyOutput{Success: true}, nil
 }
 
 type mockSSHAgent struct {
@@ -43,10 +59,20 @@ func (m mockSSHAgent) Add(key agent.AddedKey) error {
 	return nil
 }
 
+func (m mockSSHAgent) Remove(key ssh.PublicKey) error {
+	return nil
+}
+
 func TestMain(m *testing.M) {
+	tmpDir, _ := os.MkdirTemp("", "awssh")
+
+	os.Setenv("AWSSH_KNOWN_HOSTS_FILE", filepath.Join(tmpDir, "known_hosts"))
+	// the key push cache is kept in the awssh config directory of the home
+	os.Setenv("HOME", tmpDir)
 	config.Load()
-	logging.NewLogger(false)
+	logging.NewLogger(logging.Options{}) // nolint: errcheck
 	code := m.Run()
+	os.RemoveAll(tmpDir)
 	os.Exit(code)
 }
 
@@ -58,8 +84,16 @@ func TestShellProcessSuccess(t *testing.T) {
 	os.Exit(0)
 }
 
-func fakeShellCommand() func(name string, args ...string) *exec.Cmd {
-	return func(name string, args ...string) *exec.Cmd {
+func TestShellProcessConnectionFailure(t *testing.T) {
+	if os.Getenv("GO_TEST_PROCESS") != "1" {
+		return
+	}
+
+	os.Exit(255)
+}
+
+func fakeShellCommand() ShellCommandFunc {
+	return func(ctx context.Context, name string, args ...string) *exec.Cmd {
 		cs := []string{
 			"-test.run=TestShellProcessSuccess",
 			"--",
@@ -67,29 +101,29 @@ func fakeShellCommand() func(name string, args ...string) *exec.Cmd {
 		}
 
 		cs = append(cs, args...)
-		cmd := exec.Command(os.Args[0], cs...)
+		cmd := exec.CommandContext(ctx, os.Args[0], cs...)
 		cmd.Env = []string{"GO_TEST_PROCESS=1"}
 		return cmd
 	}
 }
 
 func TestConnect(t *testing.T) {
-	defaultInstance := &ec2.Instance{
+	defaultInstance := &ec2types.Instance{
 		InstanceId:       aws.String("i-1234567890"),
 		PrivateIpAddress: aws.String("10.10.5.100"),
-		Tags: []*ec2.Tag{
+		Tags: []ec2types.Tag{
 			{
 				Key:   aws.String("Environment"),
 				Value: aws.String("production"),
 			},
 		},
-		Placement: &ec2.Placement{
+		Placement: &ec2types.Placement{
 			AvailabilityZone: aws.String("ap-southeast-1a"),
 		},
 	}
 
 	instance := NewInstance(defaultInstance)
-	mockEC2InstanceConnectAPI := mockEC2InstanceConnectAPI{
+	mockEC2InstanceConnectAPI := &mockEC2InstanceConnectAPI{
 		expectedInput: &ec2instanceconnect.SendSSHPublicKeyInput{
 			InstanceId: aws.String("i-1234567890"),
 		},
@@ -98,6 +132,350 @@ func TestConnect(t *testing.T) {
 	shellCommand := fakeShellCommand()
 
 	mockSSHAgent := mockSSHAgent{}
-	err := instance.Connect(mockSSHAgent, mockEC2InstanceConnectAPI, shellCommand, false)
+	err := instance.Connect(context.Background(), mockSSHAgent, mockEC2InstanceConnectAPI, shellCommand, false)
 	assert.Nil(t, err)
+
+	t.Run("send ssh public key with invalid args", func(t *testing.T) {
+		mockEC2InstanceConnectAPI.expectedInput.InstanceId = aws.String("i-0987654321")
+
+		err := instance.Connect(context.Background(), mockSSHAgent, mockEC2InstanceConnectAPI, shellCommand, false)
+		assert.True(t, errors.Is(err, errdefs.ErrInvalidArgs))
+		assert.Equal(t, errdefs.ExitCodeInvalidArgs, errdefs.ExitCode(err))
+	})
+
+	t.Run("cancelled connect", func(t *testing.T) {
+		mockEC2InstanceConnectAPI.expectedInput.InstanceId = aws.String("i-1234567890")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := instance.Connect(ctx, mockSSHAgent, mockEC2InstanceConnectAPI, shellCommand, false)
+		assert.True(t, errors.Is(err, errdefs.ErrCancelled))
+	})
+
+	t.Run("no public IP", func(t *testing.T) {
+		err := instance.Connect(context.Background(), mockSSHAgent, mockEC2InstanceConnectAPI, shellCommand, true)
+		assert.True(t, errors.Is(err, errdefs.ErrNotFound))
+	})
+
+	t.Run("no private IP", func(t *testing.T) {
+		// a pending or terminated instance has neither a network interface nor a placement
+		instance := NewInstance(&ec2types.Instance{InstanceId: aws.String("i-1234567890")})
+		assert.Equal(t, "", instance.PrivateIP)
+
+		err := instance.Connect(context.Background(), mockSSHAgent, mockEC2InstanceConnectAPI, shellCommand, false)
+		assert.True(t, errors.Is(err, errdefs.ErrNotFound))
+	})
+
+	t.Run("malformed ssh options", func(t *testing.T) {
+		flagSet := pflag.NewFlagSet("awssh", pflag.ContinueOnError)
+		config.AddEC2AccessFlags(flagSet)
+
+		sshOpts := config.GetSSHOpts()
+		defer flagSet.Set("ssh-opts", sshOpts) // nolint: errcheck
+
+		assert.Nil(t, flagSet.Set("ssh-opts", `-o "ProxyCommand=nc %h %p`))
+		err := instance.Connect(context.Background(), mockSSHAgent, mockEC2InstanceConnectAPI, shellCommand, false)
+		assert.True(t, errors.Is(err, errdefs.ErrInvalidArgs))
+	})
+}
+
+func TestRetryEC2InstanceConnectClient(t *testing.T) {
+	t.Run("retry with custom retryable codes", func(t *testing.T) {
+		policy := NewRetryPolicy(5, time.Millisecond, 2*time.Millisecond, "ThrottlingException")
+		client := &mockEC2InstanceConnectAPI{failures: []error{
+			&smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"},
+		}}
+
+		out, err := NewRetryEC2InstanceConnectClient(client, policy).SendSSHPublicKey(context.Background(), &ec2instanceconnect.SendSSHPublicKeyInput{})
+		assert.Nil(t, err)
+		assert.True(t, out.Success)
+		assert.Equal(t, 2, client.calls)
+	})
+
+	t.Run("code not listed in custom retryable codes", func(t *testing.T) {
+		policy := NewRetryPolicy(5, 0, 0, "ThrottlingException")
+		client := &mockEC2InstanceConnectAPI{failures: []error{
+			&smithy.GenericAPIError{Code: "ServiceException", Message: "Internal error"},
+		}}
+
+		_, err := NewRetryEC2InstanceConnectClient(client, policy).SendSSHPublicKey(context.Background(), &ec2instanceconnect.SendSSHPublicKeyInput{})
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, client.calls)
+	})
+}
+
+func TestRemoteCommand(t *testing.T) {
+	testCases := []struct {
+		name     string
+		command  string
+		tmux     string
+		expected string
+	}{
+		{name: "no remote command"},
+		{name: "command", command: "sudo -i", expected: `sudo -i; exec "$SHELL" -l`},
+		{name: "tmux session", tmux: "main", expected: "tmux new-session -A -s 'main'"},
+		{name: "command in tmux session", command: "cd /opt/app", tmux: "ops's", expected: `tmux new-session -A -s 'ops'\''s' 'cd /opt/app; exec "$SHELL" -l'`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, remoteCommand(tc.command, tc.tmux))
+		})
+	}
+}
+
+func TestPushSSHPublicKeyCache(t *testing.T) {
+	instance := &Instance{
+		Name:             "jenkins-master",
+		InstanceID:       "i-0b22a22eec53b9321",
+		PrivateIP:        "10.10.5.101",
+		AvailabilityZone: "ap-southeast-1a",
+	}
+	session := &sshsession.Session{PublicKey: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOzaY60WhT78A2KlT9OYB+yPzqOJlpjmG8R8EIMqPVqx", Fingerprint: "SHA256:jenkins"}
+	client := &mockEC2InstanceConnectAPI{}
+
+	_, err := instance.PushSSHPublicKey(context.Background(), client, session, "ec2-user", false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, client.calls)
+
+	t.Run("skip the key still valid", func(t *testing.T) {
+		_, err := instance.PushSSHPublicKey(context.Background(), client, session, "ec2-user", false)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, client.calls)
+	})
+
+	t.Run("push for another OS user", func(t *testing.T) {
+		_, err := instance.PushSSHPublicKey(context.Background(), client, session, "ubuntu", false)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, client.calls)
+	})
+
+	t.Run("force push", func(t *testing.T) {
+		flagSet := pflag.NewFlagSet("awssh", pflag.ContinueOnError)
+		config.AddEC2AccessFlags(flagSet)
+		defer flagSet.Set("force-push", "false") // nolint: errcheck
+
+		assert.Nil(t, flagSet.Set("force-push", "true"))
+		_, err := instance.PushSSHPublicKey(context.Background(), client, session, "ec2-user", false)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, client.calls)
+	})
+
+	t.Run("push the temporary keypair of every session", func(t *testing.T) {
+		keyring := agent.NewKeyring().(agent.ExtendedAgent)
+
+		for calls := 4; calls <= 5; calls++ {
+			tmpSession, err := sshsession.NewSession(keyring, instance.InstanceID)
+			assert.Nil(t, err)
+
+			_, err = instance.PushSSHPublicKey(context.Background(), client, tmpSession, "ec2-user", false)
+			assert.Nil(t, err)
+			assert.Equal(t, calls, client.calls)
+			assert.Nil(t, tmpSession.Close())
+		}
+	})
+}
+
+func TestConnectMultiplex(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	flagSet := pflag.NewFlagSet("awssh", pflag.ContinueOnError)
+	config.AddEC2AccessFlags(flagSet)
+	defer flagSet.Set("multiplex", "false") // nolint: errcheck
+	assert.Nil(t, flagSet.Set("multiplex", "true"))
+
+	instance := &Instance{
+		Name:             "jenkins-master",
+		InstanceID:       "i-0c33a33eec53b9321",
+		PrivateIP:        "10.10.5.102",
+		AvailabilityZone: "ap-southeast-1a",
+	}
+	client := &mockEC2InstanceConnectAPI{}
+
+	var sshArgs []string
+	shellCommand := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		sshArgs = args
+		return fakeShellCommand()(ctx, name, args...)
+	}
+
+	controlPath, err := sshsession.ControlPath(config.GetRuntimeDir(), instance.InstanceID, config.GetSSHUsername(), config.GetSSHPort())
+	assert.Nil(t, err)
+
+	t.Run("first connection becomes the master", func(t *testing.T) {
+		err := instance.Connect(context.Background(), mockSSHAgent{}, client, shellCommand, false)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, client.calls)
+		assert.Contains(t, sshArgs, "ControlPath="+controlPath)
+		assert.Contains(t, sshArgs, "ControlMaster=auto")
+	})
+
+	t.Run("connection through the running master", func(t *testing.T) {
+		listener, err := net.Listen("unix", controlPath)
+		assert.Nil(t, err)
+		defer listener.Close()
+
+		err = instance.Connect(context.Background(), mockSSHAgent{}, client, shellCommand, false)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, client.calls)
+		assert.Contains(t, sshArgs, "ControlPath="+controlPath)
+	})
+
+	failedCommand := func(ctx context.Context) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=TestShellProcessConnectionFailure")
+		cmd.Env = []string{"GO_TEST_PROCESS=1"}
+		return cmd
+	}
+
+	t.Run("master not answering", func(t *testing.T) {
+		listener, err := net.Listen("unix", controlPath)
+		assert.Nil(t, err)
+		defer listener.Close()
+
+		calls := client.calls
+		shellCommand := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			if slices.Contains(args, "check") {
+				return failedCommand(ctx)
+			}
+			return fakeShellCommand()(ctx, name, args...)
+		}
+
+		err = instance.Connect(context.Background(), mockSSHAgent{}, client, shellCommand, false)
+		assert.Nil(t, err)
+		assert.Equal(t, calls+1, client.calls)
+	})
+
+	t.Run("master gone before the connection", func(t *testing.T) {
+		listener, err := net.Listen("unix", controlPath)
+		assert.Nil(t, err)
+		defer listener.Close()
+
+		calls := client.calls
+		runs := 0
+		shellCommand := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			if slices.Contains(args, "check") {
+				return fakeShellCommand()(ctx, name, args...)
+			}
+			runs++
+			if runs > 1 {
+				return fakeShellCommand()(ctx, name, args...)
+			}
+			// the master exits while ssh connects, ssh fails to authenticate as a new master
+			listener.Close()
+			return failedCommand(ctx)
+		}
+
+		err = instance.Connect(context.Background(), mockSSHAgent{}, client, shellCommand, false)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, runs)
+		assert.Equal(t, calls+1, client.calls)
+	})
+
+	t.Run("remote command not run again", func(t *testing.T) {
+		defer flagSet.Set("remote-command", config.GetRemoteCommand()) // nolint: errcheck
+		assert.Nil(t, flagSet.Set("remote-command", "./deploy.sh"))
+
+		listener, err := net.Listen("unix", controlPath)
+		assert.Nil(t, err)
+		defer listener.Close()
+
+		calls := client.calls
+		runs := 0
+		shellCommand := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			if slices.Contains(args, "check") {
+				return fakeShellCommand()(ctx, name, args...)
+			}
+			runs++
+			// the master exits during the session, and the remote command exits with 255 as well
+			listener.Close()
+			return failedCommand(ctx)
+		}
+
+		err = instance.Connect(context.Background(), mockSSHAgent{}, client, shellCommand, false)
+		assert.Equal(t, 255, errdefs.ExitCode(err))
+		assert.Equal(t, 1, runs)
+		assert.Equal(t, calls, client.calls)
+	})
+}
+
+func TestConnectHostKeyOptsOrder(t *testing.T) {
+	flagSet := pflag.NewFlagSet("awssh", pflag.ContinueOnError)
+	config.AddEC2AccessFlags(flagSet)
+	defer flagSet.Set("known-hosts-file", config.GetKnownHostsFile()) // nolint: errcheck
+	defer flagSet.Set("ssh-opts", config.GetSSHOpts())                // nolint: errcheck
+	defer flagSet.Set("strict-host-key-checking", "false")            // nolint: errcheck
+	assert.Nil(t, flagSet.Set("known-hosts-file", filepath.Join(t.TempDir(), "known_hosts")))
+	assert.Nil(t, flagSet.Set("ssh-opts", "-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null"))
+	assert.Nil(t, flagSet.Set("strict-host-key-checking", "true"))
+
+	instance := &Instance{
+		Name:       "jenkins-master",
+		InstanceID: "i-0387e016c47c6170c",
+		PrivateIP:  "10.10.5.102",
+		HostKeys:   []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOzaY60WhT78A2KlT9OYB+yPzqOJlpjmG8R8EIMqPVqx"},
+	}
+
+	var sshArgs []string
+	shellCommand := func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		sshArgs = args
+		return fakeShellCommand()(ctx, name, args...)
+	}
+
+	err := instance.Connect(context.Background(), mockSSHAgent{}, &mockEC2InstanceConnectAPI{}, shellCommand, false)
+	assert.Nil(t, err)
+
+	// ssh keeps the first value of an option, the user ssh options cannot turn off the verification
+	index := func(arg string) int {
+		for i, a := range sshArgs {
+			if a == arg {
+				return i
+			}
+		}
+		return -1
+	}
+	assert.True(t, index("StrictHostKeyChecking=yes") >= 0)
+	assert.Less(t, index("StrictHostKeyChecking=yes"), index("StrictHostKeyChecking=no"))
+	assert.Less(t, index("UserKnownHostsFile="+config.GetKnownHostsFile()), index("UserKnownHostsFile=/dev/null"))
+}
+
+func TestRecordHostKeys(t *testing.T) {
+	flagSet := pflag.NewFlagSet("awssh", pflag.ContinueOnError)
+	config.AddEC2AccessFlags(flagSet)
+	defer flagSet.Set("known-hosts-file", config.GetKnownHostsFile()) // nolint: errcheck
+	defer flagSet.Set("accept-changed-host-key", "false")             // nolint: errcheck
+	assert.Nil(t, flagSet.Set("known-hosts-file", filepath.Join(t.TempDir(), "known_hosts")))
+
+	instance := &Instance{
+		Name:       "jenkins-master",
+		InstanceID: "i-0387e016c47c6170c",
+		HostKeys:   []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOzaY60WhT78A2KlT9OYB+yPzqOJlpjmG8R8EIMqPVqx"},
+	}
+
+	knownHostsFile, strictMode, err := instance.RecordHostKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, config.GetKnownHostsFile(), knownHostsFile)
+	assert.Equal(t, "yes", strictMode)
+
+	instance.HostKeys = []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAILl1RwT0Wtj4MibGf8VkQzdV5yF7tAw1QdqpGSQiIk4w"}
+
+	t.Run("refuse the changed host keys", func(t *testing.T) {
+		_, _, err := instance.RecordHostKeys()
+		assert.True(t, errors.Is(err, errdefs.ErrSSHFailure))
+
+		content, err := os.ReadFile(config.GetKnownHostsFile())
+		assert.Nil(t, err)
+		assert.Contains(t, string(content), "AAAAIOzaY60WhT78A2KlT9OYB")
+	})
+
+	t.Run("accept the changed host keys", func(t *testing.T) {
+		assert.Nil(t, flagSet.Set("accept-changed-host-key", "true"))
+
+		_, strictMode, err := instance.RecordHostKeys()
+		assert.Nil(t, err)
+		assert.Equal(t, "yes", strictMode)
+
+		content, err := os.ReadFile(config.GetKnownHostsFile())
+		assert.Nil(t, err)
+		assert.Contains(t, string(content), "AAAAILl1RwT0Wtj4MibGf8VkQzdV5yF7tAw1QdqpGSQiIk4w")
+	})
 }
@@ -0,0 +1,178 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+
+	"awssh/internal/errdefs"
+	"awssh/internal/logging"
+)
+
+// IAM actions required by awssh to access an EC2 instance
+const (
+	ActionDescribeInstances = "ec2:DescribeInstances"
+	ActionSendSSHPublicKey  = "ec2-instance-connect:SendSSHPublicKey"
+)
+
+// Permission represent an IAM action on a resource to be simulated
+type Permission struct {
+	Action   string
+	Resource string
+	// Context is the string condition keys of the request, e.g. ec2:osuser
+	Context map[string]string
+}
+
+// PermissionResult represent the simulated decision of a Permission
+type PermissionResult struct {
+	Permission
+	// Decision is either allowed, explicitDeny or implicitDeny
+	Decision string
+}
+
+// Allowed reports whether the permission is allowed
+func (r PermissionResult) Allowed() bool {
+	return r.Decision == string(iamtypes.PolicyEvaluationDecisionTypeAllowed)
+}
+
+// Preflight checks the permissions required by awssh with the IAM policy simulation,
+// before attempting the connection
+type Preflight struct {
+	Identity *Identity
+	// PrincipalARN is the IAM user or role ARN of the identity used as the simulation policy source
+	PrincipalARN string
+
+	client IAMAPI
+}
+
+// NewPreflight creates a new Preflight for the identity of the credentials
+func NewPreflight(ctx context.Context, stsAPI STSAPI, iamAPI IAMAPI) (*Preflight, error) {
+	identity, err := GetCallerIdentity(ctx, stsAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	principalARN, err := principalARN(ctx, iamAPI, identity.ARN)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Logger().Debugf("awssh: simulating the IAM policies of %s", principalARN)
+
+	return &Preflight{
+		Identity:     identity,
+		PrincipalARN: principalARN,
+		client:       iamAPI,
+	}, nil
+}
+
+// DescribeInstancesPermission get the permission required to find the EC2 instances
+func (p *Preflight) DescribeInstancesPermission() Permission {
+	return Permission{
+		Action:   ActionDescribeInstances,
+		Resource: "*",
+	}
+}
+
+// SendSSHPublicKeyPermission get the permission required to push the ssh public key of the OS user to the EC2 instance
+func (p *Preflight) SendSSHPublicKeyPermission(region, instanceID, osUser string) Permission {
+	partition := "aws"
+	if parsed, err := arn.Parse(p.Identity.ARN); err == nil {
+		partition = parsed.Partition
+	}
+
+	return Permission{
+		Action:   ActionSendSSHPublicKey,
+		Resource: fmt.Sprintf("arn:%s:ec2:%s:%s:instance/%s", partition, region, p.Identity.Account, instanceID),
+		Context: map[string]string{
+			"ec2:osuser": osUser,
+		},
+	}
+}
+
+// Check simulates the permissions against the IAM policies of the principal
+func (p *Preflight) Check(ctx context.Context, permissions ...Permission) ([]PermissionResult, error) {
+	results := make([]PermissionResult, 0, len(permissions))
+
+	for _, permission := range permissions {
+		input := &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(p.PrincipalARN),
+			ActionNames:     []string{permission.Action},
+			ResourceArns:    []string{permission.Resource},
+		}
+
+		for key, value := range permission.Context {
+			input.ContextEntries = append(input.ContextEntries, iamtypes.ContextEntry{
+				ContextKeyName:   aws.String(key),
+				ContextKeyType:   iamtypes.ContextKeyTypeEnumString,
+				ContextKeyValues: []string{value},
+			})
+		}
+
+		out, err := p.client.SimulatePrincipalPolicy(ctx, input)
+		if err != nil {
+			return nil, wrapError(err, "unable to simulate the IAM policies of %s", p.PrincipalARN)
+		}
+
+		result := PermissionResult{
+			Permission: permission,
+			Decision:   string(iamtypes.PolicyEvaluationDecisionTypeImplicitDeny),
+		}
+		for _, evaluation := range out.EvaluationResults {
+			if aws.ToString(evaluation.EvalActionName) == permission.Action {
+				result.Decision = string(evaluation.EvalDecision)
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// MissingPermissions get the error listing the permissions which are not allowed, if any
+func MissingPermissions(principalARN string, results []PermissionResult) error {
+	var missing []string
+	for _, result := range results {
+		if !result.Allowed() {
+			missing = append(missing, fmt.Sprintf("%s on %s (%s)", result.Action, result.Resource, result.Decision))
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return errdefs.New(errdefs.ErrAuthDenied, "%s is missing the permissions: %s", principalARN, strings.Join(missing, ", "))
+}
+
+// principalARN get the IAM user or role ARN of the caller identity ARN,
+// the assumed role session ARN is resolved to the role ARN including its path
+func principalARN(ctx context.Context, client IAMAPI, callerARN string) (string, error) {
+	parsed, err := arn.Parse(callerARN)
+	if err != nil {
+		return "", errdefs.Wrap(errdefs.ErrInvalidArgs, err, "invalid caller identity ARN '%s'", callerARN)
+	}
+
+	parts := strings.Split(parsed.Resource, "/")
+
+	switch {
+	case parsed.Service == "iam" && parts[0] == "user":
+		return callerARN, nil
+
+	case parsed.Service == "sts" && parts[0] == "assumed-role" && len(parts) >= 2:
+		out, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(parts[1])})
+		if err != nil {
+			logging.Logger().Debugf("awssh: unable to get the IAM role '%s', assuming no role path: %v", parts[1], err)
+			return fmt.Sprintf("arn:%s:iam::%s:role/%s", parsed.Partition, parsed.AccountID, parts[1]), nil
+		}
+		return aws.ToString(out.Role.Arn), nil
+	}
+
+	return "", errdefs.New(errdefs.ErrInvalidArgs, "IAM policy simulation is not supported for %s", callerARN)
+}
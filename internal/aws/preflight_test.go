@@ -0,0 +1,163 @@
+package aws_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	. "awssh/internal/aws"
+	"awssh/internal/errdefs"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSTS struct {
+	STSAPI
+
+	arn string
+}
+
+func (m *mockSTS) GetCallerIdentity(ctx context.Context, input *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String("123456789012"),
+		Arn:     aws.String(m.arn),
+		UserId:  aws.String("AROAEXAMPLE:john"),
+	}, nil
+}
+
+type mockIAM struct {
+	IAMAPI
+
+	roleErr error
+	// allowed is the allowed actions with the required ec2:osuser, if any
+	allowed map[string]string
+	inputs  []*iam.SimulatePrincipalPolicyInput
+}
+
+func (m *mockIAM) GetRole(ctx context.Context, input *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	if m.roleErr != nil {
+		return nil, m.roleErr
+	}
+
+	return &iam.GetRoleOutput{
+		Role: &iamtypes.Role{
+			Arn: aws.String("arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/" + *input.RoleName),
+		},
+	}, nil
+}
+
+func (m *mockIAM) SimulatePrincipalPolicy(ctx context.Context, input *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+	m.inputs = append(m.inputs, input)
+
+	action := input.ActionNames[0]
+	decision := iamtypes.PolicyEvaluationDecisionTypeImplicitDeny
+
+	if osUser, ok := m.allowed[action]; ok {
+		decision = iamtypes.PolicyEvaluationDecisionTypeAllowed
+		for _, entry := range input.ContextEntries {
+			if *entry.ContextKeyName == "ec2:osuser" && osUser != "" && entry.ContextKeyValues[0] != osUser {
+				decision = iamtypes.PolicyEvaluationDecisionTypeExplicitDeny
+			}
+		}
+	}
+
+	return &iam.SimulatePrincipalPolicyOutput{
+		EvaluationResults: []iamtypes.EvaluationResult{
+			{
+				EvalActionName:   aws.String(action),
+				EvalResourceName: aws.String(input.ResourceArns[0]),
+				EvalDecision:     decision,
+			},
+		},
+	}, nil
+}
+
+func TestNewPreflight(t *testing.T) {
+	tests := []struct {
+		name      string
+		callerARN string
+		iam       *mockIAM
+		expected  string
+		err       error
+	}{
+		{
+			name:      "iam user",
+			callerARN: "arn:aws:iam::123456789012:user/devops/john",
+			iam:       &mockIAM{},
+			expected:  "arn:aws:iam::123456789012:user/devops/john",
+		},
+		{
+			name:      "assumed role is resolved with its path",
+			callerARN: "arn:aws:sts::123456789012:assumed-role/AWSReservedSSO_Admin_0123/john",
+			iam:       &mockIAM{},
+			expected:  "arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/AWSReservedSSO_Admin_0123",
+		},
+		{
+			name:      "assumed role without iam:GetRole permission",
+			callerARN: "arn:aws-cn:sts::123456789012:assumed-role/Admin/john",
+			iam:       &mockIAM{roleErr: &smithy.GenericAPIError{Code: "AccessDenied"}},
+			expected:  "arn:aws-cn:iam::123456789012:role/Admin",
+		},
+		{
+			name:      "root account is not supported",
+			callerARN: "arn:aws:iam::123456789012:root",
+			iam:       &mockIAM{},
+			err:       errdefs.ErrInvalidArgs,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preflight, err := NewPreflight(context.Background(), &mockSTS{arn: tt.callerARN}, tt.iam)
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err))
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, preflight.PrincipalARN)
+		})
+	}
+}
+
+func TestPreflightCheck(t *testing.T) {
+	client := &mockIAM{allowed: map[string]string{
+		ActionDescribeInstances: "",
+		ActionSendSSHPublicKey:  "ec2-user",
+	}}
+
+	preflight, err := NewPreflight(context.Background(), &mockSTS{arn: "arn:aws:iam::123456789012:user/john"}, client)
+	assert.Nil(t, err)
+
+	t.Run("all permissions are allowed", func(t *testing.T) {
+		results, err := preflight.Check(context.Background(),
+			preflight.DescribeInstancesPermission(),
+			preflight.SendSSHPublicKeyPermission("ap-southeast-1", "i-12345678abcd", "ec2-user"),
+		)
+		assert.Nil(t, err)
+		assert.Len(t, results, 2)
+		assert.Nil(t, MissingPermissions(preflight.PrincipalARN, results))
+
+		input := client.inputs[len(client.inputs)-1]
+		assert.Equal(t, []string{"arn:aws:ec2:ap-southeast-1:123456789012:instance/i-12345678abcd"}, input.ResourceArns)
+		assert.Equal(t, "ec2:osuser", *input.ContextEntries[0].ContextKeyName)
+	})
+
+	t.Run("report the missing permission", func(t *testing.T) {
+		results, err := preflight.Check(context.Background(),
+			preflight.SendSSHPublicKeyPermission("ap-southeast-1", "i-12345678abcd", "root"),
+		)
+		assert.Nil(t, err)
+		assert.False(t, results[0].Allowed())
+
+		err = MissingPermissions(preflight.PrincipalARN, results)
+		assert.True(t, errors.Is(err, errdefs.ErrAuthDenied))
+		assert.True(t, strings.Contains(err.Error(), "ec2-instance-connect:SendSSHPublicKey on arn:aws:ec2:ap-southeast-1:123456789012:instance/i-12345678abcd (explicitDeny)"))
+	})
+}
@@ -1,46 +1,62 @@
 package aws
 
 import (
-	"fmt"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"context"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	astypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"awssh/internal/errdefs"
 )
 
+// instanceIDPattern matches an EC2 instance-id, e.g. i-0387e016c47c6170c
+var instanceIDPattern = regexp.MustCompile(`^i-[0-9a-f]{8,17}$`)
+
 type Provider struct {
-	Client ec2iface.EC2API
+	Client EC2API
+
+	// Resolvers resolve the targets which are not an EC2 reference, they are tried before the EC2 lookups
+	Resolvers []Resolver
 }
 
-func NewProvider(client ec2iface.EC2API) *Provider {
+func NewProvider(client EC2API, resolvers ...Resolver) *Provider {
 	provider := &Provider{
-		Client: client,
+		Client:    client,
+		Resolvers: resolvers,
 	}
 
 	return provider
 }
 
-func (p Provider) GetInstanceWithID(instanceID string) ([]*Instance, error) {
+// GetInstanceWithID get the EC2 instance with the instance-id
+func (p Provider) GetInstanceWithID(ctx context.Context, instanceID string) ([]*Instance, error) {
 	input := &ec2.DescribeInstancesInput{
-		InstanceIds: []*string{
-			aws.String(instanceID),
+		InstanceIds: []string{
+			instanceID,
 		},
 	}
 
-	out, err := p.Client.DescribeInstances(input)
+	out, err := p.Client.DescribeInstances(ctx, input)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err, "unable to describe EC2 instances")
 	}
 
 	if len(out.Reservations) == 0 {
-		return nil, fmt.Errorf("awssh: no instance found")
+		return nil, errdefs.New(errdefs.ErrNotFound, "no instance found")
 	}
 
 	instances := p.convert(out.Reservations)
 	return instances, nil
 }
 
-func (p Provider) GetInstanceWithTag(tags string) ([]*Instance, error) {
+// GetInstanceWithTag get the running EC2 instances filtered by the tags
+func (p Provider) GetInstanceWithTag(ctx context.Context, tags string) ([]*Instance, error) {
 	filters, err := PrepareEC2Filters(tags)
 	if err != nil {
 		return nil, err
@@ -50,25 +66,184 @@ func (p Provider) GetInstanceWithTag(tags string) ([]*Instance, error) {
 		Filters: filters,
 	}
 
-	out, err := p.Client.DescribeInstances(input)
+	out, err := p.Client.DescribeInstances(ctx, input)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err, "unable to describe EC2 instances")
 	}
 
 	if len(out.Reservations) == 0 {
-		return nil, fmt.Errorf("awssh: no instance found")
+		return nil, errdefs.New(errdefs.ErrNotFound, "no instance found")
 	}
 
 	instances := p.convert(out.Reservations)
 	return instances, nil
 }
 
-func (p Provider) convert(ec2Reservations []*ec2.Reservation) []*Instance {
+// GetRunningInstances get all of the running EC2 instances
+func (p Provider) GetRunningInstances(ctx context.Context) ([]*Instance, error) {
+	input := &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"running"},
+			},
+		},
+	}
+
+	out, err := p.Client.DescribeInstances(ctx, input)
+	if err != nil {
+		return nil, wrapError(err, "unable to describe EC2 instances")
+	}
+
+	return p.convert(out.Reservations), nil
+}
+
+// GetInstanceWithTarget get the EC2 instances matching the target, which is either a target of the resolvers,
+// an instance-id, a private or public IP, a private or public DNS name or a Name tag value.
+// The lookups are tried in that order and the first lookup having a match is used
+func (p Provider) GetInstanceWithTarget(ctx context.Context, target string) ([]*Instance, error) {
+	target = strings.TrimSpace(target)
+
+	if target == "" {
+		return nil, errdefs.New(errdefs.ErrInvalidArgs, "empty target")
+	}
+
+	for _, resolver := range p.Resolvers {
+		if !resolver.Match(target) {
+			continue
+		}
+
+		instanceID, err := resolver.Resolve(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+
+		return p.GetInstanceWithID(ctx, instanceID)
+	}
+
+	if instanceIDPattern.MatchString(target) {
+		return p.GetInstanceWithID(ctx, target)
+	}
+
+	var filterNames []string
+	switch {
+	case net.ParseIP(target) != nil:
+		filterNames = []string{"private-ip-address", "ip-address"}
+	case strings.Contains(target, "."):
+		// a Name tag value may contain dots too, e.g. web.production
+		filterNames = []string{"private-dns-name", "dns-name", "tag:Name"}
+	default:
+		filterNames = []string{"tag:Name"}
+	}
+
+	for _, filterName := range filterNames {
+		instances, err := p.getInstanceWithFilter(ctx, filterName, target)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(instances) > 0 {
+			return instances, nil
+		}
+	}
+
+	return nil, errdefs.New(errdefs.ErrNotFound, "no instance found matching '%s'", target)
+}
+
+// GetInstanceWithASG get the running EC2 instances which are in-service and healthy members of the auto-scaling group
+func (p Provider) GetInstanceWithASG(ctx context.Context, client AutoScalingAPI, name string) ([]*Instance, error) {
+	out, err := client.DescribeAutoScalingGroups(ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []string{name},
+	})
+	if err != nil {
+		return nil, wrapError(err, "unable to describe auto-scaling group '%s'", name)
+	}
+
+	if len(out.AutoScalingGroups) == 0 {
+		return nil, errdefs.New(errdefs.ErrNotFound, "no auto-scaling group found with name '%s'", name)
+	}
+
+	instanceIDs := make([]string, 0)
+	for _, member := range out.AutoScalingGroups[0].Instances {
+		if member.LifecycleState == astypes.LifecycleStateInService && aws.ToString(member.HealthStatus) == "Healthy" {
+			instanceIDs = append(instanceIDs, aws.ToString(member.InstanceId))
+		}
+	}
+
+	if len(instanceIDs) == 0 {
+		return nil, errdefs.New(errdefs.ErrNotFound, "no in-service instance found in auto-scaling group '%s'", name)
+	}
+
+	input := &ec2.DescribeInstancesInput{
+		InstanceIds: instanceIDs,
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"running"},
+			},
+		},
+	}
+
+	ec2Out, err := p.Client.DescribeInstances(ctx, input)
+	if err != nil {
+		return nil, wrapError(err, "unable to describe EC2 instances")
+	}
+
+	instances := p.convert(ec2Out.Reservations)
+	if len(instances) == 0 {
+		return nil, errdefs.New(errdefs.ErrNotFound, "no running instance found in auto-scaling group '%s'", name)
+	}
+
+	return instances, nil
+}
+
+// GetPasswordData get the encrypted administrator password data of the Windows instance
+func (p Provider) GetPasswordData(ctx context.Context, instance *Instance) (string, error) {
+	out, err := p.Client.GetPasswordData(ctx, &ec2.GetPasswordDataInput{
+		InstanceId: aws.String(instance.InstanceID),
+	})
+	if err != nil {
+		return "", wrapError(err, "unable to get password data of EC2 instance '%s' (%s)", instance.Name, instance.InstanceID)
+	}
+
+	passwordData := strings.TrimSpace(aws.ToString(out.PasswordData))
+	if passwordData == "" {
+		return "", errdefs.New(errdefs.ErrNotFound, "no password available for EC2 instance '%s' (%s), "+
+			"it is available a few minutes after launch when the instance is launched with a key pair", instance.Name, instance.InstanceID)
+	}
+
+	return passwordData, nil
+}
+
+// getInstanceWithFilter get the running EC2 instances matching the filter
+func (p Provider) getInstanceWithFilter(ctx context.Context, name, value string) ([]*Instance, error) {
+	input := &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"running"},
+			},
+			{
+				Name:   aws.String(name),
+				Values: []string{value},
+			},
+		},
+	}
+
+	out, err := p.Client.DescribeInstances(ctx, input)
+	if err != nil {
+		return nil, wrapError(err, "unable to describe EC2 instances")
+	}
+
+	return p.convert(out.Reservations), nil
+}
+
+func (p Provider) convert(ec2Reservations []types.Reservation) []*Instance {
 	out := make([]*Instance, 0)
 
 	for i := range ec2Reservations {
-		for _, inst := range ec2Reservations[i].Instances {
-			out = append(out, NewInstance(inst))
+		for j := range ec2Reservations[i].Instances {
+			out = append(out, NewInstance(&ec2Reservations[i].Instances[j]))
 		}
 	}
 	return out
@@ -2,34 +2,51 @@ package aws_test
 
 import (
 	. "awssh/internal/aws"
+	"awssh/internal/errdefs"
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	astypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockEC2 struct {
-	ec2iface.EC2API
+	EC2API
 
-	expectedOutput *ec2.DescribeInstancesOutput
+	expectedOutput        *ec2.DescribeInstancesOutput
+	expectedConsoleOutput *ec2.GetConsoleOutputOutput
+	failures              []error
+	calls                 int
 }
 
-func (m *mockEC2) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+func (m *mockEC2) DescribeInstances(ctx context.Context, input *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	m.calls++
+	if m.calls <= len(m.failures) {
+		return nil, m.failures[m.calls-1]
+	}
+
 	return m.expectedOutput, nil
 }
 
+func (m *mockEC2) GetConsoleOutput(ctx context.Context, input *ec2.GetConsoleOutputInput, optFns ...func(*ec2.Options)) (*ec2.GetConsoleOutputOutput, error) {
+	return m.expectedConsoleOutput, nil
+}
+
 func TestGetInstanceWithID(t *testing.T) {
 	expectedOutput := &ec2.DescribeInstancesOutput{
-		Reservations: []*ec2.Reservation{
+		Reservations: []types.Reservation{
 			{
-				Instances: []*ec2.Instance{
+				Instances: []types.Instance{
 					{
 						InstanceId:       aws.String("i-12345678abcd"),
 						PrivateIpAddress: aws.String("192.168.1.100"),
-						Placement: &ec2.Placement{
+						Placement: &types.Placement{
 							AvailabilityZone: aws.String("ap-southeast-1a"),
 						},
 					},
@@ -39,7 +56,7 @@ func TestGetInstanceWithID(t *testing.T) {
 	}
 	provider := NewProvider(&mockEC2{expectedOutput: expectedOutput})
 
-	instance, err := provider.GetInstanceWithID("i-12345678abcd")
+	instance, err := provider.GetInstanceWithID(context.Background(), "i-12345678abcd")
 	assert.Nil(t, err)
 	assert.NotNil(t, instance)
 	assert.Equal(t, *expectedOutput.Reservations[0].Instances[0].InstanceId, instance[0].InstanceID)
@@ -49,16 +66,16 @@ func TestGetInstanceWithTag(t *testing.T) {
 
 	t.Run("instance having tag name", func(t *testing.T) {
 		expectedOutput := &ec2.DescribeInstancesOutput{
-			Reservations: []*ec2.Reservation{
+			Reservations: []types.Reservation{
 				{
-					Instances: []*ec2.Instance{
+					Instances: []types.Instance{
 						{
 							InstanceId:       aws.String("i-12345678abcd"),
 							PrivateIpAddress: aws.String("192.168.1.100"),
-							Placement: &ec2.Placement{
+							Placement: &types.Placement{
 								AvailabilityZone: aws.String("ap-southeast-1a"),
 							},
-							Tags: []*ec2.Tag{
+							Tags: []types.Tag{
 								{
 									Key:   aws.String("Name"),
 									Value: aws.String("lalala"),
@@ -70,7 +87,7 @@ func TestGetInstanceWithTag(t *testing.T) {
 			},
 		}
 		provider := NewProvider(&mockEC2{expectedOutput: expectedOutput})
-		instance, err := provider.GetInstanceWithTag("Name=lalala")
+		instance, err := provider.GetInstanceWithTag(context.Background(), "Name=lalala")
 		assert.Nil(t, err)
 		assert.NotNil(t, instance)
 		assert.Equal(t, *expectedOutput.Reservations[0].Instances[0].Tags[0].Value, instance[0].Name)
@@ -79,27 +96,270 @@ func TestGetInstanceWithTag(t *testing.T) {
 
 	t.Run("instance without tag name", func(t *testing.T) {
 		expectedOutput := &ec2.DescribeInstancesOutput{
-			Reservations: []*ec2.Reservation{
+			Reservations: []types.Reservation{
 				{
-					Instances: []*ec2.Instance{
+					Instances: []types.Instance{
 						{
 							InstanceId:       aws.String("i-12345678abcd"),
 							PrivateIpAddress: aws.String("192.168.1.100"),
 							PublicIpAddress:  aws.String("36.86.63.182"),
-							Placement: &ec2.Placement{
+							Placement: &types.Placement{
 								AvailabilityZone: aws.String("ap-southeast-1a"),
 							},
-							Tags: []*ec2.Tag{},
+							Tags: []types.Tag{},
 						},
 					},
 				},
 			},
 		}
 		provider := NewProvider(&mockEC2{expectedOutput: expectedOutput})
-		instance, err := provider.GetInstanceWithTag("Name=lalala")
+		instance, err := provider.GetInstanceWithTag(context.Background(), "Name=lalala")
 		assert.Nil(t, err)
 		assert.NotNil(t, instance)
 		assert.Equal(t, fmt.Sprintf("ec2:noname:%s", *expectedOutput.Reservations[0].Instances[0].InstanceId), instance[0].Name)
 		assert.Equal(t, *expectedOutput.Reservations[0].Instances[0].PublicIpAddress, instance[0].PublicIP)
 	})
 }
+
+type filterEC2 struct {
+	EC2API
+
+	// instances keyed by the filter name and value, e.g. tag:Name=web
+	instances map[string][]types.Instance
+	filters   []string
+}
+
+func (m *filterEC2) DescribeInstances(ctx context.Context, input *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	key := ""
+	for _, filter := range input.Filters {
+		if *filter.Name != "instance-state-name" {
+			key = fmt.Sprintf("%s=%s", *filter.Name, filter.Values[0])
+		}
+	}
+	if len(input.InstanceIds) > 0 {
+		key = fmt.Sprintf("instance-id=%s", input.InstanceIds[0])
+	}
+	m.filters = append(m.filters, key)
+
+	out := &ec2.DescribeInstancesOutput{}
+	if instances, ok := m.instances[key]; ok {
+		out.Reservations = []types.Reservation{{Instances: instances}}
+	}
+	return out, nil
+}
+
+func TestGetInstanceWithTarget(t *testing.T) {
+	newInstance := func(id string) types.Instance {
+		return types.Instance{
+			InstanceId:       aws.String(id),
+			PrivateIpAddress: aws.String("10.0.1.10"),
+			Placement: &types.Placement{
+				AvailabilityZone: aws.String("ap-southeast-1a"),
+			},
+		}
+	}
+
+	client := &filterEC2{instances: map[string][]types.Instance{
+		"instance-id=i-0387e016c47c6170c":                               {newInstance("i-0387e016c47c6170c")},
+		"ip-address=54.1.2.3":                                           {newInstance("i-00000000000000001")},
+		"private-ip-address=10.0.1.10":                                  {newInstance("i-00000000000000002")},
+		"private-dns-name=ip-10-0-1-10.ap-southeast-1.compute.internal": {newInstance("i-00000000000000003")},
+		"tag:Name=web.production":                                       {newInstance("i-00000000000000004")},
+		"tag:Name=jenkins":                                              {newInstance("i-00000000000000005"), newInstance("i-00000000000000006")},
+	}}
+
+	tests := []struct {
+		name     string
+		target   string
+		expected []string
+		filters  []string
+	}{
+		{"instance-id", "i-0387e016c47c6170c", []string{"i-0387e016c47c6170c"}, []string{"instance-id=i-0387e016c47c6170c"}},
+		{"private ip", "10.0.1.10", []string{"i-00000000000000002"}, []string{"private-ip-address=10.0.1.10"}},
+		{"public ip", "54.1.2.3", []string{"i-00000000000000001"}, []string{"private-ip-address=54.1.2.3", "ip-address=54.1.2.3"}},
+		{"private dns name", "ip-10-0-1-10.ap-southeast-1.compute.internal", []string{"i-00000000000000003"}, []string{"private-dns-name=ip-10-0-1-10.ap-southeast-1.compute.internal"}},
+		{"name tag with dots", "web.production", []string{"i-00000000000000004"}, []string{"private-dns-name=web.production", "dns-name=web.production", "tag:Name=web.production"}},
+		{"name tag matching several instances", "jenkins", []string{"i-00000000000000005", "i-00000000000000006"}, []string{"tag:Name=jenkins"}},
+		{"name tag starting with i-", "i-love-prod", nil, []string{"tag:Name=i-love-prod"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.filters = nil
+			instances, err := NewProvider(client).GetInstanceWithTarget(context.Background(), tt.target)
+			assert.Equal(t, tt.filters, client.filters)
+
+			if tt.expected == nil {
+				assert.True(t, errors.Is(err, errdefs.ErrNotFound))
+				return
+			}
+
+			assert.Nil(t, err)
+			ids := make([]string, 0, len(instances))
+			for _, instance := range instances {
+				ids = append(ids, instance.InstanceID)
+			}
+			assert.Equal(t, tt.expected, ids)
+		})
+	}
+
+	t.Run("empty target", func(t *testing.T) {
+		_, err := NewProvider(client).GetInstanceWithTarget(context.Background(), " ")
+		assert.True(t, errors.Is(err, errdefs.ErrInvalidArgs))
+	})
+}
+
+type mockAutoScaling struct {
+	AutoScalingAPI
+
+	groups   []astypes.AutoScalingGroup
+	failures []error
+	calls    int
+}
+
+func (m *mockAutoScaling) DescribeAutoScalingGroups(ctx context.Context, input *autoscaling.DescribeAutoScalingGroupsInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	m.calls++
+	if m.calls <= len(m.failures) {
+		return nil, m.failures[m.calls-1]
+	}
+
+	out := &autoscaling.DescribeAutoScalingGroupsOutput{}
+	for _, group := range m.groups {
+		if *group.AutoScalingGroupName == input.AutoScalingGroupNames[0] {
+			out.AutoScalingGroups = append(out.AutoScalingGroups, group)
+		}
+	}
+	return out, nil
+}
+
+type instanceIDsEC2 struct {
+	EC2API
+
+	instanceIDs []string
+}
+
+func (m *instanceIDsEC2) DescribeInstances(ctx context.Context, input *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	m.instanceIDs = input.InstanceIds
+
+	instances := make([]types.Instance, 0, len(input.InstanceIds))
+	for _, id := range input.InstanceIds {
+		instances = append(instances, types.Instance{
+			InstanceId:       aws.String(id),
+			PrivateIpAddress: aws.String("10.0.1.10"),
+			Placement:        &types.Placement{AvailabilityZone: aws.String("ap-southeast-1a")},
+			Tags:             []types.Tag{{Key: aws.String(TagASGName), Value: aws.String("web-prod")}},
+		})
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []types.Reservation{{Instances: instances}}}, nil
+}
+
+func TestGetInstanceWithASG(t *testing.T) {
+	member := func(id string, state astypes.LifecycleState, health string) astypes.Instance {
+		return astypes.Instance{InstanceId: aws.String(id), LifecycleState: state, HealthStatus: aws.String(health)}
+	}
+
+	asgClient := &mockAutoScaling{groups: []astypes.AutoScalingGroup{
+		{
+			AutoScalingGroupName: aws.String("web-prod"),
+			Instances: []astypes.Instance{
+				member("i-00000000000000001", astypes.LifecycleStateInService, "Healthy"),
+				member("i-00000000000000002", astypes.LifecycleStatePending, "Healthy"),
+				member("i-00000000000000003", astypes.LifecycleStateInService, "Unhealthy"),
+				member("i-00000000000000004", astypes.LifecycleStateInService, "Healthy"),
+			},
+		},
+		{
+			AutoScalingGroupName: aws.String("worker-prod"),
+			Instances: []astypes.Instance{
+				member("i-00000000000000005", astypes.LifecycleStateTerminating, "Healthy"),
+			},
+		},
+	}}
+	ec2Client := &instanceIDsEC2{}
+	provider := NewProvider(ec2Client)
+
+	instances, err := provider.GetInstanceWithASG(context.Background(), asgClient, "web-prod")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"i-00000000000000001", "i-00000000000000004"}, ec2Client.instanceIDs)
+	assert.Len(t, instances, 2)
+	assert.Equal(t, "web-prod", instances[0].ASGName)
+
+	t.Run("no in-service instance", func(t *testing.T) {
+		_, err := provider.GetInstanceWithASG(context.Background(), asgClient, "worker-prod")
+		assert.True(t, errors.Is(err, errdefs.ErrNotFound))
+	})
+
+	t.Run("unknown auto-scaling group", func(t *testing.T) {
+		_, err := provider.GetInstanceWithASG(context.Background(), asgClient, "api-prod")
+		assert.True(t, errors.Is(err, errdefs.ErrNotFound))
+	})
+}
+
+func TestNodeAwareness(t *testing.T) {
+	newInstance := func(id string, tags map[string]string) *Instance {
+		instance := types.Instance{
+			InstanceId:       aws.String(id),
+			PrivateIpAddress: aws.String("10.0.1.10"),
+			Placement:        &types.Placement{AvailabilityZone: aws.String("ap-southeast-1a")},
+		}
+		for key, value := range tags {
+			instance.Tags = append(instance.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+		return NewInstance(&instance)
+	}
+
+	eksNode := newInstance("i-00000000000000001", map[string]string{
+		TagASGName:           "eks-workers-3abc",
+		"eks:cluster-name":   "production",
+		"eks:nodegroup-name": "workers",
+	})
+	selfManagedNode := newInstance("i-00000000000000002", map[string]string{
+		"kubernetes.io/cluster/staging": "owned",
+	})
+	ecsInstance := newInstance("i-00000000000000003", map[string]string{
+		TagASGName:            "ecs-prod",
+		"aws:ecs:clusterName": "production",
+	})
+	standalone := newInstance("i-00000000000000004", nil)
+
+	assert.Equal(t, "eks-workers-3abc", eksNode.ASGName)
+	assert.Equal(t, "eks:production/workers", eksNode.Cluster())
+	assert.Equal(t, "eks:staging", selfManagedNode.Cluster())
+	assert.Equal(t, "ecs:production", ecsInstance.Cluster())
+	assert.Equal(t, "", standalone.Cluster())
+
+	instances := []*Instance{standalone, eksNode, selfManagedNode, ecsInstance}
+	SortByASG(instances)
+	assert.Equal(t, []*Instance{ecsInstance, eksNode, standalone, selfManagedNode}, instances)
+}
+
+type passwordEC2 struct {
+	EC2API
+
+	passwordData string
+}
+
+func (m *passwordEC2) GetPasswordData(ctx context.Context, input *ec2.GetPasswordDataInput, optFns ...func(*ec2.Options)) (*ec2.GetPasswordDataOutput, error) {
+	return &ec2.GetPasswordDataOutput{InstanceId: input.InstanceId, PasswordData: aws.String(m.passwordData)}, nil
+}
+
+func TestGetPasswordData(t *testing.T) {
+	instance := NewInstance(&types.Instance{
+		InstanceId:       aws.String("i-0387e016c47c6170c"),
+		PrivateIpAddress: aws.String("10.0.1.10"),
+		Placement:        &types.Placement{AvailabilityZone: aws.String("ap-southeast-1a")},
+		Platform:         types.PlatformValuesWindows,
+		KeyName:          aws.String("windows-prod"),
+	})
+	assert.True(t, instance.IsWindows())
+	assert.Equal(t, "windows-prod", instance.KeyName)
+
+	passwordData, err := NewProvider(&passwordEC2{passwordData: "\r\nZW5jcnlwdGVk\r\n"}).GetPasswordData(context.Background(), instance)
+	assert.Nil(t, err)
+	assert.Equal(t, "ZW5jcnlwdGVk", passwordData)
+
+	t.Run("password is not available yet", func(t *testing.T) {
+		_, err := NewProvider(&passwordEC2{}).GetPasswordData(context.Background(), instance)
+		assert.True(t, errors.Is(err, errdefs.ErrNotFound))
+	})
+}
@@ -0,0 +1,55 @@
+package aws
+
+import (
+	"regexp"
+	"strings"
+
+	"awssh/config"
+)
+
+// instanceRefPattern matches an EC2 instance-id within a command line argument, optionally prefixed by the user,
+// e.g. i-0387e016c47c6170c:/srv/app, ec2-user@i-0387e016c47c6170c or ssh://ec2-user@i-0387e016c47c6170c:22/repo.git
+var instanceRefPattern = regexp.MustCompile(`(?:([\w.-]+)@)?(i-[0-9a-f]{8,17})`)
+
+// InstanceRef represent an EC2 instance referenced by a command line, with the user to log in as
+type InstanceRef struct {
+	InstanceID string
+	User       string
+}
+
+// FindInstanceRefs finds the EC2 instances referenced as an ssh destination by the command line arguments,
+// i.e. the instance-id is a whole host, not part of a longer word. The user defaults to the ssh username,
+// and each instance and user pair is returned once in the order of appearance
+func FindInstanceRefs(args []string) []InstanceRef {
+	var (
+		refs []InstanceRef
+		seen = make(map[InstanceRef]bool)
+	)
+
+	for _, arg := range args {
+		for _, match := range instanceRefPattern.FindAllStringSubmatchIndex(arg, -1) {
+			start, end := match[0], match[1]
+			if start > 0 && !strings.ContainsRune("/,=", rune(arg[start-1])) {
+				continue
+			}
+			if end < len(arg) && !strings.ContainsRune(":/,", rune(arg[end])) {
+				continue
+			}
+
+			ref := InstanceRef{
+				InstanceID: arg[match[4]:match[5]],
+				User:       config.GetSSHUsername(),
+			}
+			if match[2] >= 0 {
+				ref.User = arg[match[2]:match[3]]
+			}
+
+			if !seen[ref] {
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	return refs
+}
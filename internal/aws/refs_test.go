@@ -0,0 +1,62 @@
+package aws_test
+
+import (
+	"testing"
+
+	"awssh/config"
+	. "awssh/internal/aws"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindInstanceRefs(t *testing.T) {
+	user := config.GetSSHUsername()
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []InstanceRef
+	}{
+		{
+			name:     "rsync destination",
+			args:     []string{"-av", "./dist", "i-0387e016c47c6170c:/srv/app"},
+			expected: []InstanceRef{{InstanceID: "i-0387e016c47c6170c", User: user}},
+		},
+		{
+			name: "scp with users",
+			args: []string{"ubuntu@i-0387e016c47c6170c:/var/log/syslog", "ec2-user@i-0b22a22eec53b9321:/tmp/"},
+			expected: []InstanceRef{
+				{InstanceID: "i-0387e016c47c6170c", User: "ubuntu"},
+				{InstanceID: "i-0b22a22eec53b9321", User: "ec2-user"},
+			},
+		},
+		{
+			name:     "git url",
+			args:     []string{"clone", "ssh://git@i-0387e016c47c6170c:22/srv/repo.git"},
+			expected: []InstanceRef{{InstanceID: "i-0387e016c47c6170c", User: "git"}},
+		},
+		{
+			name: "ansible host pattern",
+			args: []string{"-i", "i-0387e016c47c6170c,i-0b22a22eec53b9321,", "all", "-m", "ping"},
+			expected: []InstanceRef{
+				{InstanceID: "i-0387e016c47c6170c", User: user},
+				{InstanceID: "i-0b22a22eec53b9321", User: user},
+			},
+		},
+		{
+			name:     "repeated reference",
+			args:     []string{"i-0387e016c47c6170c", "uptime", "i-0387e016c47c6170c:/tmp"},
+			expected: []InstanceRef{{InstanceID: "i-0387e016c47c6170c", User: user}},
+		},
+		{
+			name: "part of a word",
+			args: []string{"backup-i-0387e016c47c6170c.tar", "i-0387e016c47c6170cx", "./dist"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, FindInstanceRefs(tc.args))
+		})
+	}
+}
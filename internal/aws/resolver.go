@@ -0,0 +1,125 @@
+package aws
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+
+	"awssh/internal/errdefs"
+)
+
+// Resolver resolves a target which is not an EC2 reference, e.g. an ECS task or an EKS node,
+// into the instance-id of the EC2 instance hosting it
+type Resolver interface {
+	// Match reports whether the target is handled by the resolver
+	Match(target string) bool
+	// Resolve get the instance-id of the EC2 instance of the target
+	Resolve(ctx context.Context, target string) (string, error)
+}
+
+var (
+	// ecsTaskARNPattern matches an ECS task ARN having the cluster name,
+	// e.g. arn:aws:ecs:ap-southeast-1:123456789012:task/production/0a1b2c3d4e5f67890a1b2c3d4e5f6789
+	ecsTaskARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:ecs:[a-z0-9-]+:\d{12}:task/([\w-]+)/[\w-]+$`)
+	// eksProviderIDPattern matches the providerID of an EKS node, e.g. aws:///ap-southeast-1a/i-0387e016c47c6170c
+	eksProviderIDPattern = regexp.MustCompile(`^aws:///?[a-z0-9-]*/(i-[0-9a-f]{8,17})$`)
+)
+
+// ecsTargetPrefix is the prefix of an ECS task target given with its cluster, e.g. ecs:production/0a1b2c3d4e5f6789
+const ecsTargetPrefix = "ecs:"
+
+// ECSTaskResolver resolves an ECS task into its container instance
+type ECSTaskResolver struct {
+	Client ECSAPI
+}
+
+// NewECSTaskResolver creates a new ECSTaskResolver
+func NewECSTaskResolver(client ECSAPI) *ECSTaskResolver {
+	return &ECSTaskResolver{
+		Client: client,
+	}
+}
+
+// Match reports whether the target is an ECS task ARN or 'ecs:<cluster>/<task>'
+func (r *ECSTaskResolver) Match(target string) bool {
+	return strings.HasPrefix(target, ecsTargetPrefix) || ecsTaskARNPattern.MatchString(target)
+}
+
+// Resolve get the instance-id of the container instance running the ECS task
+func (r *ECSTaskResolver) Resolve(ctx context.Context, target string) (string, error) {
+	cluster, task, err := parseECSTask(target)
+	if err != nil {
+		return "", err
+	}
+
+	tasks, err := r.Client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(cluster),
+		Tasks:   []string{task},
+	})
+	if err != nil {
+		return "", wrapError(err, "unable to describe ECS task '%s'", task)
+	}
+
+	if len(tasks.Tasks) == 0 {
+		return "", errdefs.New(errdefs.ErrNotFound, "no ECS task found with '%s' in cluster '%s'", task, cluster)
+	}
+
+	containerInstanceARN := aws.ToString(tasks.Tasks[0].ContainerInstanceArn)
+	if containerInstanceARN == "" {
+		return "", errdefs.New(errdefs.ErrInvalidArgs, "ECS task '%s' is not running on an EC2 container instance, e.g. a Fargate task", task)
+	}
+
+	containerInstances, err := r.Client.DescribeContainerInstances(ctx, &ecs.DescribeContainerInstancesInput{
+		Cluster:            aws.String(cluster),
+		ContainerInstances: []string{containerInstanceARN},
+	})
+	if err != nil {
+		return "", wrapError(err, "unable to describe ECS container instance '%s'", containerInstanceARN)
+	}
+
+	if len(containerInstances.ContainerInstances) == 0 || aws.ToString(containerInstances.ContainerInstances[0].Ec2InstanceId) == "" {
+		return "", errdefs.New(errdefs.ErrNotFound, "no EC2 instance found for ECS container instance '%s'", containerInstanceARN)
+	}
+
+	return aws.ToString(containerInstances.ContainerInstances[0].Ec2InstanceId), nil
+}
+
+// parseECSTask get the cluster and task of an ECS task target
+func parseECSTask(target string) (cluster, task string, err error) {
+	if matches := ecsTaskARNPattern.FindStringSubmatch(target); matches != nil {
+		return matches[1], target, nil
+	}
+
+	cluster, task, ok := strings.Cut(strings.TrimPrefix(target, ecsTargetPrefix), "/")
+	if !ok || cluster == "" || task == "" {
+		return "", "", errdefs.New(errdefs.ErrInvalidArgs, "invalid ECS task '%s', either 'ecs:<cluster>/<task>' or a task ARN having the cluster name", target)
+	}
+
+	return cluster, task, nil
+}
+
+// EKSNodeResolver resolves the providerID of an EKS node, as in 'kubectl get node -o jsonpath={.spec.providerID}'
+type EKSNodeResolver struct{}
+
+// NewEKSNodeResolver creates a new EKSNodeResolver
+func NewEKSNodeResolver() *EKSNodeResolver {
+	return &EKSNodeResolver{}
+}
+
+// Match reports whether the target is an EKS node providerID
+func (r *EKSNodeResolver) Match(target string) bool {
+	return eksProviderIDPattern.MatchString(target)
+}
+
+// Resolve get the instance-id of the EKS node, which is part of the providerID
+func (r *EKSNodeResolver) Resolve(ctx context.Context, target string) (string, error) {
+	matches := eksProviderIDPattern.FindStringSubmatch(target)
+	if matches == nil {
+		return "", errdefs.New(errdefs.ErrInvalidArgs, "invalid EKS node providerID '%s'", target)
+	}
+
+	return matches[1], nil
+}
@@ -0,0 +1,113 @@
+package aws_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "awssh/internal/aws"
+	"awssh/internal/errdefs"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockECS struct {
+	ECSAPI
+
+	// tasks and container instances keyed by the cluster and the task or container instance ARN, e.g. production/task
+	tasks              map[string]ecstypes.Task
+	containerInstances map[string]ecstypes.ContainerInstance
+}
+
+func (m *mockECS) DescribeTasks(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+	out := &ecs.DescribeTasksOutput{}
+	if task, ok := m.tasks[*input.Cluster+"/"+input.Tasks[0]]; ok {
+		out.Tasks = []ecstypes.Task{task}
+	}
+	return out, nil
+}
+
+func (m *mockECS) DescribeContainerInstances(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error) {
+	out := &ecs.DescribeContainerInstancesOutput{}
+	if containerInstance, ok := m.containerInstances[*input.Cluster+"/"+input.ContainerInstances[0]]; ok {
+		out.ContainerInstances = []ecstypes.ContainerInstance{containerInstance}
+	}
+	return out, nil
+}
+
+func TestECSTaskResolver(t *testing.T) {
+	const (
+		taskARN              = "arn:aws:ecs:ap-southeast-1:123456789012:task/production/0a1b2c3d4e5f67890a1b2c3d4e5f6789"
+		containerInstanceARN = "arn:aws:ecs:ap-southeast-1:123456789012:container-instance/production/5f6789a1b2c3d4e"
+	)
+
+	resolver := NewECSTaskResolver(&mockECS{
+		tasks: map[string]ecstypes.Task{
+			"production/" + taskARN:                            {ContainerInstanceArn: aws.String(containerInstanceARN)},
+			"production/0a1b2c3d4e5f67890a1b2c3d4e5f6789":      {ContainerInstanceArn: aws.String(containerInstanceARN)},
+			"production/fargate0a1b2c3d4e5f67890a1b2c3d4e5f67": {},
+		},
+		containerInstances: map[string]ecstypes.ContainerInstance{
+			"production/" + containerInstanceARN: {Ec2InstanceId: aws.String("i-0387e016c47c6170c")},
+		},
+	})
+
+	for _, target := range []string{taskARN, "ecs:production/0a1b2c3d4e5f67890a1b2c3d4e5f6789"} {
+		assert.True(t, resolver.Match(target), target)
+
+		instanceID, err := resolver.Resolve(context.Background(), target)
+		assert.Nil(t, err)
+		assert.Equal(t, "i-0387e016c47c6170c", instanceID)
+	}
+
+	assert.False(t, resolver.Match("i-0387e016c47c6170c"))
+	assert.False(t, resolver.Match("jenkins-master"))
+
+	t.Run("fargate task", func(t *testing.T) {
+		_, err := resolver.Resolve(context.Background(), "ecs:production/fargate0a1b2c3d4e5f67890a1b2c3d4e5f67")
+		assert.True(t, errors.Is(err, errdefs.ErrInvalidArgs))
+	})
+
+	t.Run("unknown task", func(t *testing.T) {
+		_, err := resolver.Resolve(context.Background(), "ecs:staging/0a1b2c3d4e5f67890a1b2c3d4e5f6789")
+		assert.True(t, errors.Is(err, errdefs.ErrNotFound))
+	})
+
+	t.Run("task without cluster", func(t *testing.T) {
+		_, err := resolver.Resolve(context.Background(), "ecs:0a1b2c3d4e5f67890a1b2c3d4e5f6789")
+		assert.True(t, errors.Is(err, errdefs.ErrInvalidArgs))
+	})
+}
+
+func TestEKSNodeResolver(t *testing.T) {
+	resolver := NewEKSNodeResolver()
+
+	assert.True(t, resolver.Match("aws:///ap-southeast-1a/i-0387e016c47c6170c"))
+	assert.False(t, resolver.Match("ip-10-0-1-10.ap-southeast-1.compute.internal"))
+
+	instanceID, err := resolver.Resolve(context.Background(), "aws:///ap-southeast-1a/i-0387e016c47c6170c")
+	assert.Nil(t, err)
+	assert.Equal(t, "i-0387e016c47c6170c", instanceID)
+}
+
+func TestGetInstanceWithTargetResolvers(t *testing.T) {
+	client := &filterEC2{instances: map[string][]types.Instance{
+		"instance-id=i-0387e016c47c6170c": {{
+			InstanceId:       aws.String("i-0387e016c47c6170c"),
+			PrivateIpAddress: aws.String("10.0.1.10"),
+			Placement:        &types.Placement{AvailabilityZone: aws.String("ap-southeast-1a")},
+		}},
+	}}
+	provider := NewProvider(client, NewECSTaskResolver(&mockECS{}), NewEKSNodeResolver())
+
+	instances, err := provider.GetInstanceWithTarget(context.Background(), "aws:///ap-southeast-1a/i-0387e016c47c6170c")
+	assert.Nil(t, err)
+	assert.Equal(t, "i-0387e016c47c6170c", instances[0].InstanceID)
+
+	_, err = provider.GetInstanceWithTarget(context.Background(), "ecs:production/0a1b2c3d4e5f67890a1b2c3d4e5f6789")
+	assert.True(t, errors.Is(err, errdefs.ErrNotFound))
+}
@@ -0,0 +1,282 @@
+package aws
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+
+	"awssh/internal/logging"
+)
+
+// DefaultRetryableCodes is the AWS error codes which are retried by default
+var DefaultRetryableCodes = []string{
+	"Throttling",
+	"ThrottlingException",
+	"RequestLimitExceeded",
+	"ServiceUnavailable",
+	"InternalError",
+	"ServiceException",
+	ErrCodeRequestError,
+}
+
+// RetryPolicy represent a retry policy with an exponential backoff and full jitter
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one
+	MaxAttempts int
+	// BaseDelay is the backoff delay of the first retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay
+	MaxDelay time.Duration
+	// RetryableCodes is the AWS error codes to be retried
+	RetryableCodes map[string]bool
+}
+
+// NewRetryPolicy creates a new RetryPolicy, when no retryable codes are given DefaultRetryableCodes is used
+func NewRetryPolicy(maxAttempts int, baseDelay, maxDelay time.Duration, retryableCodes ...string) *RetryPolicy {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	if len(retryableCodes) == 0 {
+		retryableCodes = DefaultRetryableCodes
+	}
+
+	codes := make(map[string]bool)
+	for _, code := range retryableCodes {
+		codes[code] = true
+	}
+
+	return &RetryPolicy{
+		MaxAttempts:    maxAttempts,
+		BaseDelay:      baseDelay,
+		MaxDelay:       maxDelay,
+		RetryableCodes: codes,
+	}
+}
+
+// Retryable reports whether the error is retryable by the policy
+func (p *RetryPolicy) Retryable(err error) bool {
+	return p.RetryableCodes[errorCode(err)]
+}
+
+// Backoff get the delay before the given retry attempt (starting from 1)
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << uint(attempt-1)
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+// Do runs the operation fn and retries it on a retryable error following the policy
+// The retry is stopped once the context is done
+func (p *RetryPolicy) Do(ctx context.Context, operation string, fn func() error) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= p.MaxAttempts || !p.Retryable(err) {
+			return err
+		}
+
+		delay := p.Backoff(attempt)
+		logging.Logger().Debugf("awssh: %s attempt %d/%d failed, retrying in %s: %v", operation, attempt, p.MaxAttempts, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+type retryEC2Client struct {
+	EC2API
+
+	policy *RetryPolicy
+}
+
+// NewRetryEC2Client wraps the EC2 client to retry the API calls used by awssh following the policy
+func NewRetryEC2Client(client EC2API, policy *RetryPolicy) EC2API {
+	return &retryEC2Client{
+		EC2API: client,
+		policy: policy,
+	}
+}
+
+func (c *retryEC2Client) DescribeInstances(ctx context.Context, input *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (out *ec2.DescribeInstancesOutput, err error) {
+	err = c.policy.Do(ctx, "DescribeInstances", func() error {
+		out, err = c.EC2API.DescribeInstances(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *retryEC2Client) GetConsoleOutput(ctx context.Context, input *ec2.GetConsoleOutputInput, optFns ...func(*ec2.Options)) (out *ec2.GetConsoleOutputOutput, err error) {
+	err = c.policy.Do(ctx, "GetConsoleOutput", func() error {
+		out, err = c.EC2API.GetConsoleOutput(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *retryEC2Client) DescribeSecurityGroups(ctx context.Context, input *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (out *ec2.DescribeSecurityGroupsOutput, err error) {
+	err = c.policy.Do(ctx, "DescribeSecurityGroups", func() error {
+		out, err = c.EC2API.DescribeSecurityGroups(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *retryEC2Client) DescribeNetworkAcls(ctx context.Context, input *ec2.DescribeNetworkAclsInput, optFns ...func(*ec2.Options)) (out *ec2.DescribeNetworkAclsOutput, err error) {
+	err = c.policy.Do(ctx, "DescribeNetworkAcls", func() error {
+		out, err = c.EC2API.DescribeNetworkAcls(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *retryEC2Client) DescribeRouteTables(ctx context.Context, input *ec2.DescribeRouteTablesInput, optFns ...func(*ec2.Options)) (out *ec2.DescribeRouteTablesOutput, err error) {
+	err = c.policy.Do(ctx, "DescribeRouteTables", func() error {
+		out, err = c.EC2API.DescribeRouteTables(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *retryEC2Client) DescribeImages(ctx context.Context, input *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (out *ec2.DescribeImagesOutput, err error) {
+	err = c.policy.Do(ctx, "DescribeImages", func() error {
+		out, err = c.EC2API.DescribeImages(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *retryEC2Client) GetPasswordData(ctx context.Context, input *ec2.GetPasswordDataInput, optFns ...func(*ec2.Options)) (out *ec2.GetPasswordDataOutput, err error) {
+	err = c.policy.Do(ctx, "GetPasswordData", func() error {
+		out, err = c.EC2API.GetPasswordData(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *retryEC2Client) GetSerialConsoleAccessStatus(ctx context.Context, input *ec2.GetSerialConsoleAccessStatusInput, optFns ...func(*ec2.Options)) (out *ec2.GetSerialConsoleAccessStatusOutput, err error) {
+	err = c.policy.Do(ctx, "GetSerialConsoleAccessStatus", func() error {
+		out, err = c.EC2API.GetSerialConsoleAccessStatus(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+type retryEC2InstanceConnectClient struct {
+	EC2InstanceConnectAPI
+
+	policy *RetryPolicy
+}
+
+// NewRetryEC2InstanceConnectClient wraps the EC2 Instance Connect client to retry the API calls used by awssh following the policy
+func NewRetryEC2InstanceConnectClient(client EC2InstanceConnectAPI, policy *RetryPolicy) EC2InstanceConnectAPI {
+	return &retryEC2InstanceConnectClient{
+		EC2InstanceConnectAPI: client,
+		policy:                policy,
+	}
+}
+
+func (c *retryEC2InstanceConnectClient) SendSSHPublicKey(ctx context.Context, input *ec2instanceconnect.SendSSHPublicKeyInput, optFns ...func(*ec2instanceconnect.Options)) (out *ec2instanceconnect.SendSSHPublicKeyOutput, err error) {
+	err = c.policy.Do(ctx, "SendSSHPublicKey", func() error {
+		out, err = c.EC2InstanceConnectAPI.SendSSHPublicKey(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *retryEC2InstanceConnectClient) SendSerialConsoleSSHPublicKey(ctx context.Context, input *ec2instanceconnect.SendSerialConsoleSSHPublicKeyInput, optFns ...func(*ec2instanceconnect.Options)) (out *ec2instanceconnect.SendSerialConsoleSSHPublicKeyOutput, err error) {
+	err = c.policy.Do(ctx, "SendSerialConsoleSSHPublicKey", func() error {
+		out, err = c.EC2InstanceConnectAPI.SendSerialConsoleSSHPublicKey(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+type retryAutoScalingClient struct {
+	AutoScalingAPI
+
+	policy *RetryPolicy
+}
+
+// NewRetryAutoScalingClient wraps the Auto Scaling client to retry the API calls used by awssh following the policy
+func NewRetryAutoScalingClient(client AutoScalingAPI, policy *RetryPolicy) AutoScalingAPI {
+	return &retryAutoScalingClient{
+		AutoScalingAPI: client,
+		policy:         policy,
+	}
+}
+
+func (c *retryAutoScalingClient) DescribeAutoScalingGroups(ctx context.Context, input *autoscaling.DescribeAutoScalingGroupsInput, optFns ...func(*autoscaling.Options)) (out *autoscaling.DescribeAutoScalingGroupsOutput, err error) {
+	err = c.policy.Do(ctx, "DescribeAutoScalingGroups", func() error {
+		out, err = c.AutoScalingAPI.DescribeAutoScalingGroups(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+type retryECSClient struct {
+	ECSAPI
+
+	policy *RetryPolicy
+}
+
+// NewRetryECSClient wraps the ECS client to retry the API calls used by awssh following the policy
+func NewRetryECSClient(client ECSAPI, policy *RetryPolicy) ECSAPI {
+	return &retryECSClient{
+		ECSAPI: client,
+		policy: policy,
+	}
+}
+
+func (c *retryECSClient) DescribeTasks(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (out *ecs.DescribeTasksOutput, err error) {
+	err = c.policy.Do(ctx, "DescribeTasks", func() error {
+		out, err = c.ECSAPI.DescribeTasks(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (c *retryECSClient) DescribeContainerInstances(ctx context.Context, input *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (out *ecs.DescribeContainerInstancesOutput, err error) {
+	err = c.policy.Do(ctx, "DescribeContainerInstances", func() error {
+		out, err = c.ECSAPI.DescribeContainerInstances(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
+
+type retrySSMClient struct {
+	SSMAPI
+
+	policy *RetryPolicy
+}
+
+// NewRetrySSMClient wraps the SSM client to retry the API calls used by awssh following the policy
+func NewRetrySSMClient(client SSMAPI, policy *RetryPolicy) SSMAPI {
+	return &retrySSMClient{
+		SSMAPI: client,
+		policy: policy,
+	}
+}
+
+func (c *retrySSMClient) DescribeInstanceInformation(ctx context.Context, input *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (out *ssm.DescribeInstanceInformationOutput, err error) {
+	err = c.policy.Do(ctx, "DescribeInstanceInformation", func() error {
+		out, err = c.SSMAPI.DescribeInstanceInformation(ctx, input, optFns...)
+		return err
+	})
+	return out, err
+}
@@ -0,0 +1,103 @@
+package aws_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "awssh/internal/aws"
+	"awssh/internal/errdefs"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func retryEC2Output() *ec2.DescribeInstancesOutput {
+	return &ec2.DescribeInstancesOutput{
+		Reservations: []types.Reservation{
+			{
+				Instances: []types.Instance{
+					{
+						InstanceId:       aws.String("i-12345678abcd"),
+						PrivateIpAddress: aws.String("192.168.1.100"),
+						Placement: &types.Placement{
+							AvailabilityZone: aws.String("ap-southeast-1a"),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestRetryEC2Client(t *testing.T) {
+	policy := NewRetryPolicy(3, 0, 0)
+	throttled := &smithy.GenericAPIError{Code: "RequestLimitExceeded", Message: "Request limit exceeded."}
+
+	t.Run("retry transient failures", func(t *testing.T) {
+		client := &mockEC2{expectedOutput: retryEC2Output(), failures: []error{throttled, throttled}}
+		provider := NewProvider(NewRetryEC2Client(client, policy))
+
+		instances, err := provider.GetInstanceWithID(context.Background(), "i-12345678abcd")
+		assert.Nil(t, err)
+		assert.Len(t, instances, 1)
+		assert.Equal(t, 3, client.calls)
+	})
+
+	t.Run("give up after max attempts", func(t *testing.T) {
+		client := &mockEC2{expectedOutput: retryEC2Output(), failures: []error{throttled, throttled, throttled}}
+		provider := NewProvider(NewRetryEC2Client(client, policy))
+
+		_, err := provider.GetInstanceWithID(context.Background(), "i-12345678abcd")
+		assert.NotNil(t, err)
+		assert.Equal(t, 3, client.calls)
+	})
+
+	t.Run("do not retry non-retryable failures", func(t *testing.T) {
+		client := &mockEC2{expectedOutput: retryEC2Output(), failures: []error{&smithy.GenericAPIError{Code: "UnauthorizedOperation", Message: "You are not authorized."}}}
+		provider := NewProvider(NewRetryEC2Client(client, policy))
+
+		_, err := provider.GetInstanceWithID(context.Background(), "i-12345678abcd")
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, client.calls)
+	})
+
+	t.Run("stop retrying once the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		client := &mockEC2{expectedOutput: retryEC2Output(), failures: []error{throttled, throttled}}
+		provider := NewProvider(NewRetryEC2Client(client, NewRetryPolicy(3, time.Second, time.Second)))
+
+		_, err := provider.GetInstanceWithID(ctx, "i-12345678abcd")
+		assert.True(t, errors.Is(err, errdefs.ErrCancelled))
+		assert.Equal(t, 1, client.calls)
+	})
+}
+
+func TestRetryAutoScalingClient(t *testing.T) {
+	policy := NewRetryPolicy(5, time.Millisecond, 2*time.Millisecond)
+	client := &mockAutoScaling{failures: []error{
+		&smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"},
+	}}
+
+	_, err := NewRetryAutoScalingClient(client, policy).DescribeAutoScalingGroups(context.Background(), &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []string{"web-prod"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, client.calls)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := NewRetryPolicy(10, 100*time.Millisecond, time.Second)
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		delay := policy.Backoff(attempt)
+		assert.True(t, delay >= 0 && delay < time.Second)
+	}
+}
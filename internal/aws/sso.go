@@ -0,0 +1,270 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+
+	"awssh/internal/errdefs"
+	"awssh/internal/logging"
+)
+
+const (
+	ssoClientName      = "awssh"
+	ssoClientType      = "public"
+	ssoDeviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	ssoDefaultScope    = "sso:account:access"
+
+	// ssoDefaultInterval is the polling interval of the token creation when none is given by the device authorization
+	ssoDefaultInterval = 5 * time.Second
+	// ssoSlowDownInterval is added to the polling interval when asked to slow down
+	ssoSlowDownInterval = 5 * time.Second
+)
+
+// SSOProfile represent the IAM Identity Center (SSO) settings of an AWS shared config profile
+type SSOProfile struct {
+	Profile     string
+	SessionName string
+	StartURL    string
+	Region      string
+}
+
+// IsSSOTokenError reports whether the error retrieving the credentials is caused by a missing, expired or invalid SSO token,
+// which is fixed by logging in again, unlike the network errors
+func IsSSOTokenError(err error) bool {
+	var tokenErr *ssocreds.InvalidTokenError
+	return errors.As(err, &tokenErr) || errorCode(err) == "UnauthorizedException"
+}
+
+// WrapCredentialsError wraps the error retrieving the credentials of the AWS profile with the matching awssh error kind
+func WrapCredentialsError(err error, profile string) error {
+	return wrapError(err, "unable to retrieve the credentials of AWS profile '%s'", profile)
+}
+
+// LoadSSOProfile get the SSO settings of the AWS shared config profile,
+// an empty profile means the AWS_PROFILE environment variable or the default profile
+func LoadSSOProfile(ctx context.Context, profile string) (*SSOProfile, error) {
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	sharedConfig, err := config.LoadSharedConfigProfile(ctx, profile, func(o *config.LoadSharedConfigOptions) {
+		// honor the shared config files environment variables as config.LoadDefaultConfig does
+		if file := os.Getenv("AWS_CONFIG_FILE"); file != "" {
+			o.ConfigFiles = []string{file}
+		}
+		if file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); file != "" {
+			o.CredentialsFiles = []string{file}
+		}
+	})
+	if err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to load AWS profile '%s'", profile)
+	}
+
+	ssoProfile := &SSOProfile{
+		Profile:  profile,
+		StartURL: sharedConfig.SSOStartURL,
+		Region:   sharedConfig.SSORegion,
+	}
+
+	if sharedConfig.SSOSession != nil {
+		ssoProfile.SessionName = sharedConfig.SSOSession.Name
+		ssoProfile.StartURL = sharedConfig.SSOSession.SSOStartURL
+		ssoProfile.Region = sharedConfig.SSOSession.SSORegion
+	}
+
+	if ssoProfile.StartURL == "" || ssoProfile.Region == "" {
+		return nil, errdefs.New(errdefs.ErrInvalidArgs, "AWS profile '%s' is not an IAM Identity Center (SSO) profile", profile)
+	}
+
+	return ssoProfile, nil
+}
+
+// CacheKey get the key of the SSO token cache, the same key used by the AWS CLI and SDKs
+func (p *SSOProfile) CacheKey() string {
+	if p.SessionName != "" {
+		return p.SessionName
+	}
+
+	return p.StartURL
+}
+
+// SSOToken represent a cached SSO access token in the AWS CLI and SDKs format
+type SSOToken struct {
+	AccessToken           string `json:"accessToken"`
+	ExpiresAt             string `json:"expiresAt"`
+	RefreshToken          string `json:"refreshToken,omitempty"`
+	ClientID              string `json:"clientId,omitempty"`
+	ClientSecret          string `json:"clientSecret,omitempty"`
+	RegistrationExpiresAt string `json:"registrationExpiresAt,omitempty"`
+	Region                string `json:"region,omitempty"`
+	StartURL              string `json:"startUrl,omitempty"`
+}
+
+// SSODeviceAuthorization is the verification of the device authorization presented to the user
+type SSODeviceAuthorization struct {
+	VerificationURI         string
+	VerificationURIComplete string
+	UserCode                string
+}
+
+// SSOLogin perform the SSO device authorization flow
+type SSOLogin struct {
+	Client SSOOIDCAPI
+	// Notify is called once the device authorization is started,
+	// the user is expected to open the verification URI and approve the user code
+	Notify func(auth SSODeviceAuthorization)
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewSSOLogin creates a new SSOLogin
+func NewSSOLogin(client SSOOIDCAPI, notify func(auth SSODeviceAuthorization)) *SSOLogin {
+	return &SSOLogin{
+		Client: client,
+		Notify: notify,
+		now:    time.Now,
+		sleep:  sleepContext,
+	}
+}
+
+// NewSSOOIDCClient creates a new SSO OIDC client in the SSO region of the profile
+func NewSSOOIDCClient(cfg aws.Config, profile *SSOProfile) SSOOIDCAPI {
+	cfg = cfg.Copy()
+	cfg.Region = profile.Region
+
+	return ssooidc.NewFromConfig(cfg)
+}
+
+// Login performs the device authorization flow of the profile,
+// then writes the token to the standard SSO token cache
+func (l *SSOLogin) Login(ctx context.Context, profile *SSOProfile) (*SSOToken, error) {
+	var scopes []string
+	if profile.SessionName != "" {
+		scopes = []string{ssoDefaultScope}
+	}
+
+	client, err := l.Client.RegisterClient(ctx, &ssooidc.RegisterClientInput{
+		ClientName: aws.String(ssoClientName),
+		ClientType: aws.String(ssoClientType),
+		Scopes:     scopes,
+	})
+	if err != nil {
+		return nil, wrapError(err, "unable to register the SSO client")
+	}
+
+	device, err := l.Client.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     client.ClientId,
+		ClientSecret: client.ClientSecret,
+		StartUrl:     aws.String(profile.StartURL),
+	})
+	if err != nil {
+		return nil, wrapError(err, "unable to start the SSO device authorization")
+	}
+
+	if l.Notify != nil {
+		l.Notify(SSODeviceAuthorization{
+			VerificationURI:         aws.ToString(device.VerificationUri),
+			VerificationURIComplete: aws.ToString(device.VerificationUriComplete),
+			UserCode:                aws.ToString(device.UserCode),
+		})
+	}
+
+	interval := time.Duration(device.Interval) * time.Second
+	if interval <= 0 {
+		interval = ssoDefaultInterval
+	}
+
+	var token *ssooidc.CreateTokenOutput
+	for token == nil {
+		if err := l.sleep(ctx, interval); err != nil {
+			return nil, errdefs.Wrap(errdefs.FromContext(err), err, "SSO login is interrupted")
+		}
+
+		token, err = l.Client.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     client.ClientId,
+			ClientSecret: client.ClientSecret,
+			DeviceCode:   device.DeviceCode,
+			GrantType:    aws.String(ssoDeviceGrantType),
+		})
+
+		switch errorCode(err) {
+		case "":
+		case "AuthorizationPendingException":
+			logging.Logger().Debugf("awssh: waiting for the SSO device authorization to be approved")
+		case "SlowDownException":
+			interval += ssoSlowDownInterval
+		case "ExpiredTokenException":
+			return nil, errdefs.Wrap(errdefs.ErrTimeout, err, "SSO device authorization is expired before being approved")
+		default:
+			return nil, wrapError(err, "unable to create the SSO token")
+		}
+	}
+
+	now := l.now().UTC()
+	cachedToken := &SSOToken{
+		AccessToken: aws.ToString(token.AccessToken),
+		ExpiresAt:   now.Add(time.Duration(token.ExpiresIn) * time.Second).Format(time.RFC3339),
+		Region:      profile.Region,
+		StartURL:    profile.StartURL,
+	}
+
+	// the refresh token is only used by the SDKs for the sso-session profiles
+	if profile.SessionName != "" {
+		cachedToken.RefreshToken = aws.ToString(token.RefreshToken)
+		cachedToken.ClientID = aws.ToString(client.ClientId)
+		cachedToken.ClientSecret = aws.ToString(client.ClientSecret)
+		cachedToken.RegistrationExpiresAt = time.Unix(client.ClientSecretExpiresAt, 0).UTC().Format(time.RFC3339)
+	}
+
+	if err := writeSSOToken(profile, cachedToken); err != nil {
+		return nil, err
+	}
+
+	return cachedToken, nil
+}
+
+// writeSSOToken writes the token to the standard SSO token cache (~/.aws/sso/cache)
+func writeSSOToken(profile *SSOProfile, token *SSOToken) error {
+	path, err := ssocreds.StandardCachedTokenFilepath(profile.CacheKey())
+	if err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to get the SSO token cache path")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to create the SSO token cache directory")
+	}
+
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to encode the SSO token")
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to write the SSO token cache")
+	}
+
+	logging.Logger().Debugf("awssh: SSO token is cached in %s", path)
+	return nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
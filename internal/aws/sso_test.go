@@ -0,0 +1,191 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+
+	"awssh/internal/errdefs"
+)
+
+type mockSSOOIDCAPI struct {
+	SSOOIDCAPI
+
+	pending  int
+	tokenErr error
+	calls    int
+}
+
+func (m *mockSSOOIDCAPI) RegisterClient(ctx context.Context, input *ssooidc.RegisterClientInput, optFns ...func(*ssooidc.Options)) (*ssooidc.RegisterClientOutput, error) {
+	return &ssooidc.RegisterClientOutput{
+		ClientId:              aws.String("client-id"),
+		ClientSecret:          aws.String("client-secret"),
+		ClientSecretExpiresAt: 1893456000,
+	}, nil
+}
+
+func (m *mockSSOOIDCAPI) StartDeviceAuthorization(ctx context.Context, input *ssooidc.StartDeviceAuthorizationInput, optFns ...func(*ssooidc.Options)) (*ssooidc.StartDeviceAuthorizationOutput, error) {
+	return &ssooidc.StartDeviceAuthorizationOutput{
+		DeviceCode:              aws.String("device-code"),
+		UserCode:                aws.String("ABCD-EFGH"),
+		VerificationUri:         aws.String("https://device.sso.ap-southeast-1.amazonaws.com/"),
+		VerificationUriComplete: aws.String("https://device.sso.ap-southeast-1.amazonaws.com/?user_code=ABCD-EFGH"),
+		Interval:                1,
+	}, nil
+}
+
+func (m *mockSSOOIDCAPI) CreateToken(ctx context.Context, input *ssooidc.CreateTokenInput, optFns ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error) {
+	m.calls++
+	if m.tokenErr != nil {
+		return nil, m.tokenErr
+	}
+
+	if m.calls <= m.pending {
+		return nil, &smithy.GenericAPIError{Code: "AuthorizationPendingException", Message: "authorization pending"}
+	}
+
+	return &ssooidc.CreateTokenOutput{
+		AccessToken:  aws.String("access-token"),
+		RefreshToken: aws.String("refresh-token"),
+		ExpiresIn:    3600,
+	}, nil
+}
+
+func newTestSSOLogin(client SSOOIDCAPI, notify func(auth SSODeviceAuthorization)) *SSOLogin {
+	login := NewSSOLogin(client, notify)
+	login.now = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+	login.sleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+	return login
+}
+
+func TestSSOLogin(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	profile := &SSOProfile{
+		Profile:     "production",
+		SessionName: "my-sso",
+		StartURL:    "https://my-sso.awsapps.com/start",
+		Region:      "ap-southeast-1",
+	}
+
+	t.Run("cache the token once the authorization is approved", func(t *testing.T) {
+		var auth SSODeviceAuthorization
+		client := &mockSSOOIDCAPI{pending: 2}
+
+		token, err := newTestSSOLogin(client, func(a SSODeviceAuthorization) { auth = a }).Login(context.Background(), profile)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, client.calls)
+		assert.Equal(t, "ABCD-EFGH", auth.UserCode)
+		assert.Equal(t, "2020-01-01T01:00:00Z", token.ExpiresAt)
+
+		path, _ := ssocreds.StandardCachedTokenFilepath("my-sso")
+		info, err := os.Stat(path)
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+		data, _ := os.ReadFile(path)
+		cached := SSOToken{}
+		assert.Nil(t, json.Unmarshal(data, &cached))
+		assert.Equal(t, "access-token", cached.AccessToken)
+		assert.Equal(t, "refresh-token", cached.RefreshToken)
+		assert.Equal(t, "client-id", cached.ClientID)
+		assert.Equal(t, "client-secret", cached.ClientSecret)
+	})
+
+	t.Run("legacy profile is cached by the start url without refresh token", func(t *testing.T) {
+		legacy := &SSOProfile{Profile: "legacy", StartURL: "https://legacy.awsapps.com/start", Region: "ap-southeast-1"}
+
+		token, err := newTestSSOLogin(&mockSSOOIDCAPI{}, nil).Login(context.Background(), legacy)
+		assert.Nil(t, err)
+		assert.Empty(t, token.RefreshToken)
+
+		path, _ := ssocreds.StandardCachedTokenFilepath(legacy.StartURL)
+		_, err = os.Stat(path)
+		assert.Nil(t, err)
+	})
+
+	t.Run("expired device authorization", func(t *testing.T) {
+		client := &mockSSOOIDCAPI{tokenErr: &smithy.GenericAPIError{Code: "ExpiredTokenException", Message: "expired"}}
+
+		_, err := newTestSSOLogin(client, nil).Login(context.Background(), profile)
+		assert.ErrorIs(t, err, errdefs.ErrTimeout)
+	})
+
+	t.Run("denied device authorization", func(t *testing.T) {
+		client := &mockSSOOIDCAPI{tokenErr: &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "denied"}}
+
+		_, err := newTestSSOLogin(client, nil).Login(context.Background(), profile)
+		assert.ErrorIs(t, err, errdefs.ErrAuthDenied)
+	})
+
+	t.Run("cancelled while waiting for the authorization", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := newTestSSOLogin(&mockSSOOIDCAPI{pending: 1}, nil).Login(ctx, profile)
+		assert.ErrorIs(t, err, errdefs.ErrCancelled)
+	})
+}
+
+func TestLoadSSOProfile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(configFile, []byte(`
+[profile production]
+sso_session = my-sso
+sso_account_id = 123456789012
+sso_role_name = Admin
+
+[sso-session my-sso]
+sso_start_url = https://my-sso.awsapps.com/start
+sso_region = ap-southeast-1
+
+[profile static]
+region = ap-southeast-1
+`), 0600)
+	assert.Nil(t, err)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+
+	profile, err := LoadSSOProfile(context.Background(), "production")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "my-sso", profile.CacheKey())
+	assert.Equal(t, "https://my-sso.awsapps.com/start", profile.StartURL)
+	assert.Equal(t, "ap-southeast-1", profile.Region)
+
+	_, err = LoadSSOProfile(context.Background(), "static")
+	assert.ErrorIs(t, err, errdefs.ErrInvalidArgs)
+}
+
+func TestIsSSOTokenError(t *testing.T) {
+	assert.True(t, IsSSOTokenError(&ssocreds.InvalidTokenError{Err: errors.New("the SSO session has expired or is invalid")}))
+	assert.True(t, IsSSOTokenError(fmt.Errorf("failed to refresh cached credentials, %w", &smithy.GenericAPIError{Code: "UnauthorizedException"})))
+
+	sendErr := &smithyhttp.RequestSendError{Err: errors.New("dial tcp: lookup portal.sso.ap-southeast-1.amazonaws.com: no such host")}
+	assert.False(t, IsSSOTokenError(sendErr))
+	assert.ErrorIs(t, WrapCredentialsError(sendErr, "production"), errdefs.ErrNetworkUnreachable)
+
+	t.Run("SSO session expired during the API calls", func(t *testing.T) {
+		tokenErr := &smithy.OperationError{
+			ServiceID:     "EC2",
+			OperationName: "DescribeInstances",
+			Err:           fmt.Errorf("failed to refresh cached credentials, %w", &ssocreds.InvalidTokenError{Err: errors.New("the SSO session has expired or is invalid")}),
+		}
+
+		err := wrapError(tokenErr, "unable to describe EC2 instances")
+		assert.ErrorIs(t, err, errdefs.ErrAuthDenied)
+		assert.Contains(t, err.Error(), "run 'awssh login'")
+	})
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"awssh/internal/aws"
+	"awssh/internal/errdefs"
+	"awssh/internal/filelock"
+)
+
+var unsafeChars = regexp.MustCompile(`[^\w.-]`)
+
+// InstanceCache is a local cache of the running EC2 instances of a profile and region,
+// used to keep the shell completion fast
+type InstanceCache struct {
+	Path string
+	TTL  time.Duration
+
+	now func() time.Time
+}
+
+type cacheFile struct {
+	UpdatedAt time.Time       `json:"updated_at"`
+	Instances []*aws.Instance `json:"instances"`
+}
+
+// NewInstanceCache creates a new InstanceCache in the cache directory for the profile and region
+func NewInstanceCache(dir, profile, region string, ttl time.Duration) *InstanceCache {
+	if profile == "" {
+		profile = "default"
+	}
+
+	name := fmt.Sprintf("instances-%s-%s.json", unsafeChars.ReplaceAllString(profile, "_"), unsafeChars.ReplaceAllString(region, "_"))
+
+	return &InstanceCache{
+		Path: filepath.Join(dir, name),
+		TTL:  ttl,
+		now:  time.Now,
+	}
+}
+
+// Load get the cached instances, the cache is fresh when it is not older than the TTL
+func (c *InstanceCache) Load() (instances []*aws.Instance, fresh bool, err error) {
+	data, err := os.ReadFile(c.Path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to read instance cache")
+	}
+
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		// a corrupted cache is treated as a missing one, it is replaced on the next save
+		return nil, false, nil
+	}
+
+	return file.Instances, c.now().Sub(file.UpdatedAt) <= c.TTL, nil
+}
+
+// Save replaces the cached instances
+func (c *InstanceCache) Save(instances []*aws.Instance) error {
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0700); err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to create cache directory")
+	}
+
+	data, err := json.Marshal(cacheFile{
+		UpdatedAt: c.now(),
+		Instances: instances,
+	})
+	if err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to encode instance cache")
+	}
+
+	// written into a temporary file of its own first, so a concurrent completion never reads a partial cache
+	// nor fails renaming the temporary file of another one
+	if err := filelock.WriteFile(c.Path, data); err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to write instance cache")
+	}
+
+	return nil
+}
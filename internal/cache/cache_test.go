@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"awssh/internal/aws"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstanceCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	now := time.Date(2020, 9, 7, 5, 24, 52, 0, time.UTC)
+
+	c := NewInstanceCache(dir, "prod/admin", "ap-southeast-1", time.Minute)
+	c.now = func() time.Time { return now }
+	assert.Equal(t, filepath.Join(dir, "instances-prod_admin-ap-southeast-1.json"), c.Path)
+
+	t.Run("missing cache", func(t *testing.T) {
+		instances, fresh, err := c.Load()
+		assert.Nil(t, err)
+		assert.False(t, fresh)
+		assert.Empty(t, instances)
+	})
+
+	t.Run("fresh and stale cache", func(t *testing.T) {
+		expected := []*aws.Instance{
+			{Name: "jenkins-master", InstanceID: "i-0387e016c47c6170c", PrivateIP: "10.0.1.10", Tags: map[string]string{"Name": "jenkins-master"}},
+		}
+		assert.Nil(t, c.Save(expected))
+
+		instances, fresh, err := c.Load()
+		assert.Nil(t, err)
+		assert.True(t, fresh)
+		assert.Equal(t, expected, instances)
+
+		now = now.Add(2 * time.Minute)
+		instances, fresh, err = c.Load()
+		assert.Nil(t, err)
+		assert.False(t, fresh)
+		assert.Equal(t, expected, instances)
+	})
+
+	t.Run("concurrent saves", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.Nil(t, c.Save([]*aws.Instance{{Name: "jenkins-agent", InstanceID: "i-0b22a22eec53b9321"}}))
+			}()
+		}
+		wg.Wait()
+
+		entries, err := os.ReadDir(dir)
+		assert.Nil(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("corrupted cache is treated as missing", func(t *testing.T) {
+		assert.Nil(t, os.WriteFile(c.Path, []byte("{"), 0600))
+
+		instances, fresh, err := c.Load()
+		assert.Nil(t, err)
+		assert.False(t, fresh)
+		assert.Empty(t, instances)
+	})
+}
@@ -0,0 +1,158 @@
+package configfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"awssh/internal/errdefs"
+)
+
+// instanceIDPattern matches the EC2 instance-ids, an alias with them would shadow the instance
+var instanceIDPattern = regexp.MustCompile(`^i-[0-9a-f]+$`)
+
+// Alias represent a named combination of the EC2 access settings,
+// an empty setting falls back to the flags and environment variables
+type Alias struct {
+	// Target is the instance-id, Name tag value, IP or DNS name of the EC2 instance,
+	// when empty the instances are selected with the Tags
+	Target      string `yaml:"target,omitempty"`
+	Region      string `yaml:"region,omitempty"`
+	Profile     string `yaml:"profile,omitempty"`
+	Tags        string `yaml:"tags,omitempty"`
+	SSHUsername string `yaml:"ssh-username,omitempty"`
+	SSHPort     string `yaml:"ssh-port,omitempty"`
+	SSHOpts     string `yaml:"ssh-opts,omitempty"`
+	UsePublicIP bool   `yaml:"use-public-ip,omitempty"`
+
+	RemoteCommand string `yaml:"remote-command,omitempty"`
+	Tmux          string `yaml:"tmux,omitempty"`
+}
+
+// Profile represent the defaults of the connections made with an AWS shared config profile,
+// an alias setting or a flag takes precedence over the profile defaults
+type Profile struct {
+	RemoteCommand string `yaml:"remote-command,omitempty"`
+	Tmux          string `yaml:"tmux,omitempty"`
+}
+
+// File represent the awssh config file (~/.awssh/config.yaml)
+type File struct {
+	Aliases  map[string]Alias   `yaml:"aliases,omitempty"`
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+
+	path string
+}
+
+// Load reads the config file, a missing file is an empty config
+func Load(path string) (*File, error) {
+	file := &File{
+		Aliases: make(map[string]Alias),
+		path:    path,
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to read config file")
+	}
+
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrInvalidArgs, err, "malformed config file '%s'", path)
+	}
+
+	if file.Aliases == nil {
+		file.Aliases = make(map[string]Alias)
+	}
+
+	return file, nil
+}
+
+// Save writes the config file
+func (f *File) Save() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to create config directory")
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(f); err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to encode config file")
+	}
+
+	if err := os.WriteFile(f.path, buf.Bytes(), 0600); err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to write config file")
+	}
+
+	return nil
+}
+
+// GetAlias get the alias with the name
+func (f *File) GetAlias(name string) (Alias, bool) {
+	alias, ok := f.Aliases[name]
+	return alias, ok
+}
+
+// GetProfile get the defaults of the AWS shared config profile, an empty name is the default profile
+func (f *File) GetProfile(name string) (Profile, bool) {
+	if name == "" {
+		name = "default"
+	}
+
+	profile, ok := f.Profiles[name]
+	return profile, ok
+}
+
+// AddAlias adds or replaces the alias with the name, the reserved names are the awssh subcommands
+// as an alias with them is never resolved, the subcommand is run instead
+func (f *File) AddAlias(name string, alias Alias, reserved []string) error {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return errdefs.New(errdefs.ErrInvalidArgs, "invalid alias name '%s'", name)
+	}
+
+	for _, reservedName := range reserved {
+		if name == reservedName {
+			return errdefs.New(errdefs.ErrInvalidArgs, "invalid alias name '%s', it is an awssh subcommand", name)
+		}
+	}
+
+	if instanceIDPattern.MatchString(name) {
+		return errdefs.New(errdefs.ErrInvalidArgs, "invalid alias name '%s', it is an EC2 instance-id", name)
+	}
+
+	if alias.Target == "" && alias.Tags == "" {
+		return errdefs.New(errdefs.ErrInvalidArgs, "alias '%s' requires either a target or tags", name)
+	}
+
+	f.Aliases[name] = alias
+	return nil
+}
+
+// RemoveAlias removes the alias with the name
+func (f *File) RemoveAlias(name string) error {
+	if _, ok := f.Aliases[name]; !ok {
+		return errdefs.New(errdefs.ErrNotFound, "no alias found with name '%s'", name)
+	}
+
+	delete(f.Aliases, name)
+	return nil
+}
+
+// AliasNames get the sorted alias names
+func (f *File) AliasNames() []string {
+	names := make([]string, 0, len(f.Aliases))
+	for name := range f.Aliases {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,101 @@
+package configfile_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "awssh/internal/configfile"
+	"awssh/internal/errdefs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("missing file is an empty config", func(t *testing.T) {
+		file, err := Load(filepath.Join(t.TempDir(), "config.yaml"))
+		assert.Nil(t, err)
+		assert.Empty(t, file.AliasNames())
+	})
+
+	t.Run("malformed file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		assert.Nil(t, os.WriteFile(path, []byte("aliases: [\n"), 0600))
+
+		_, err := Load(path)
+		assert.True(t, errors.Is(err, errdefs.ErrInvalidArgs))
+	})
+}
+
+func TestAlias(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".awssh", "config.yaml")
+
+	file, err := Load(path)
+	assert.Nil(t, err)
+
+	reserved := []string{"doctor", "sessions"}
+
+	bastion := Alias{
+		Region:      "ap-southeast-1",
+		Profile:     "production",
+		Tags:        "Role=bastion,Environment=production",
+		SSHUsername: "centos",
+		SSHPort:     "2222",
+
+		RemoteCommand: "sudo -i",
+		Tmux:          "main",
+	}
+	assert.Nil(t, file.AddAlias("prod-db-bastion", bastion, reserved))
+	assert.Nil(t, file.AddAlias("jenkins", Alias{Target: "i-0387e016c47c6170c"}, reserved))
+	assert.Nil(t, file.Save())
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	file, err = Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"jenkins", "prod-db-bastion"}, file.AliasNames())
+
+	alias, ok := file.GetAlias("prod-db-bastion")
+	assert.True(t, ok)
+	assert.Equal(t, bastion, alias)
+
+	assert.Nil(t, file.RemoveAlias("jenkins"))
+	assert.True(t, errors.Is(file.RemoveAlias("jenkins"), errdefs.ErrNotFound))
+	assert.Equal(t, []string{"prod-db-bastion"}, file.AliasNames())
+
+	t.Run("invalid alias", func(t *testing.T) {
+		assert.True(t, errors.Is(file.AddAlias("prod db", Alias{Target: "web"}, reserved), errdefs.ErrInvalidArgs))
+		assert.True(t, errors.Is(file.AddAlias("empty", Alias{Region: "ap-southeast-1"}, reserved), errdefs.ErrInvalidArgs))
+		assert.True(t, errors.Is(file.AddAlias("doctor", Alias{Target: "web"}, reserved), errdefs.ErrInvalidArgs))
+		assert.True(t, errors.Is(file.AddAlias("sessions", Alias{Target: "web"}, reserved), errdefs.ErrInvalidArgs))
+		assert.True(t, errors.Is(file.AddAlias("i-0387e016c47c6170c", Alias{Target: "web"}, reserved), errdefs.ErrInvalidArgs))
+		assert.Nil(t, file.AddAlias("i-web", Alias{Target: "web"}, reserved))
+	})
+}
+
+func TestProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(`profiles:
+  default:
+    tmux: main
+  production:
+    remote-command: cd /opt/app
+`), 0600))
+
+	file, err := Load(path)
+	assert.Nil(t, err)
+
+	profile, ok := file.GetProfile("")
+	assert.True(t, ok)
+	assert.Equal(t, Profile{Tmux: "main"}, profile)
+
+	profile, ok = file.GetProfile("production")
+	assert.True(t, ok)
+	assert.Equal(t, Profile{RemoteCommand: "cd /opt/app"}, profile)
+
+	_, ok = file.GetProfile("staging")
+	assert.False(t, ok)
+}
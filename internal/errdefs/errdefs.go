@@ -0,0 +1,125 @@
+package errdefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Error kinds used across awssh, check them with errors.Is
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrAuthDenied         = errors.New("auth denied")
+	ErrThrottled          = errors.New("throttled")
+	ErrInvalidArgs        = errors.New("invalid arguments")
+	ErrNetworkUnreachable = errors.New("network unreachable")
+	ErrSSHFailure         = errors.New("ssh failure")
+	ErrCancelled          = errors.New("cancelled by user")
+	ErrTimeout            = errors.New("timed out")
+)
+
+// Exit codes of each error kind, following sysexits(3) where possible
+const (
+	ExitCodeGeneral            = 1
+	ExitCodeInvalidArgs        = 64
+	ExitCodeNotFound           = 68
+	ExitCodeNetworkUnreachable = 69
+	ExitCodeThrottled          = 75
+	ExitCodeSSHFailure         = 76
+	ExitCodeAuthDenied         = 77
+	ExitCodeTimeout            = 124
+	ExitCodeCancelled          = 130
+)
+
+var exitCodes = []struct {
+	kind error
+	code int
+}{
+	{ErrInvalidArgs, ExitCodeInvalidArgs},
+	{ErrNotFound, ExitCodeNotFound},
+	{ErrNetworkUnreachable, ExitCodeNetworkUnreachable},
+	{ErrThrottled, ExitCodeThrottled},
+	{ErrSSHFailure, ExitCodeSSHFailure},
+	{ErrAuthDenied, ExitCodeAuthDenied},
+	{ErrTimeout, ExitCodeTimeout},
+	{ErrCancelled, ExitCodeCancelled},
+}
+
+// Error represent an awssh error of a specific kind
+type Error struct {
+	Kind error
+	Msg  string
+	Err  error
+}
+
+// New creates a new Error of the kind
+func New(kind error, format string, args ...interface{}) error {
+	return &Error{
+		Kind: kind,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Wrap creates a new Error of the kind wrapping the cause err
+func Wrap(kind error, err error, format string, args ...interface{}) error {
+	return &Error{
+		Kind: kind,
+		Msg:  fmt.Sprintf(format, args...),
+		Err:  err,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("awssh: %s: (%v)", e.Msg, e.Err)
+	}
+	return fmt.Sprintf("awssh: %s", e.Msg)
+}
+
+// Is reports whether the error is of the target kind
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Unwrap returns the cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ExitError represent the exit status of the remote ssh command,
+// which passed through unchanged as the awssh exit code
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("awssh: ssh exited with status %d", e.Code)
+}
+
+// ExitCode get the awssh exit code of the error
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+
+	for _, c := range exitCodes {
+		if errors.Is(err, c.kind) {
+			return c.code
+		}
+	}
+
+	return ExitCodeGeneral
+}
+
+// FromContext get the error kind of a done context, either ErrTimeout or ErrCancelled
+func FromContext(ctxErr error) error {
+	if errors.Is(ctxErr, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return ErrCancelled
+}
@@ -0,0 +1,55 @@
+package errdefs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	. "awssh/internal/errdefs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("AuthException: not authorized")
+	err := Wrap(ErrAuthDenied, cause, "unable to send ssh public key")
+
+	assert.Equal(t, "awssh: unable to send ssh public key: (AuthException: not authorized)", err.Error())
+	assert.True(t, errors.Is(err, ErrAuthDenied))
+	assert.True(t, errors.Is(err, cause))
+	assert.False(t, errors.Is(err, ErrNotFound))
+
+	var awsshErr *Error
+	assert.True(t, errors.As(fmt.Errorf("wrapped: %w", err), &awsshErr))
+	assert.Equal(t, ErrAuthDenied, awsshErr.Kind)
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"no error", nil, 0},
+		{"general error", errors.New("boom"), ExitCodeGeneral},
+		{"not found", New(ErrNotFound, "no instance found"), ExitCodeNotFound},
+		{"auth denied", New(ErrAuthDenied, "denied"), ExitCodeAuthDenied},
+		{"throttled", New(ErrThrottled, "slow down"), ExitCodeThrottled},
+		{"invalid args", New(ErrInvalidArgs, "bad input"), ExitCodeInvalidArgs},
+		{"network unreachable", New(ErrNetworkUnreachable, "no route"), ExitCodeNetworkUnreachable},
+		{"ssh failure", New(ErrSSHFailure, "no ssh binary"), ExitCodeSSHFailure},
+		{"cancelled", New(ErrCancelled, "^C"), ExitCodeCancelled},
+		{"timed out", New(ErrTimeout, "deadline exceeded"), ExitCodeTimeout},
+		{"context deadline", Wrap(FromContext(context.DeadlineExceeded), context.DeadlineExceeded, "describe"), ExitCodeTimeout},
+		{"context cancelled", Wrap(FromContext(context.Canceled), context.Canceled, "describe"), ExitCodeCancelled},
+		{"remote exit status is passed through", &ExitError{Code: 42}, 42},
+		{"wrapped remote exit status", fmt.Errorf("connect: %w", &ExitError{Code: 255}), 255},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ExitCode(tt.err))
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package filelock
+
+import (
+	"os"
+	"path/filepath"
+
+	"awssh/internal/errdefs"
+)
+
+// Lock takes an exclusive lock of the lock file at the path, waiting for the other processes holding it.
+// The lock file is created when it does not exist, and the lock is released with the returned unlock
+func Lock(path string) (unlock func() error, err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to create lock file directory")
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to open lock file")
+	}
+
+	if err := lock(file); err != nil {
+		file.Close()
+		return nil, errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to lock %s", path)
+	}
+
+	return func() error {
+		defer file.Close()
+		return unlockFile(file)
+	}, nil
+}
+
+// WriteFile writes the data into a temporary file next to the file, then renames it over the file,
+// so the concurrent readers never read a partial file
+func WriteFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,46 @@
+package filelock_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "awssh/internal/filelock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "counter")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			unlock, err := Lock(path + ".lock")
+			assert.Nil(t, err)
+			defer unlock() // nolint: errcheck
+
+			data, _ := os.ReadFile(path)
+			assert.Nil(t, WriteFile(path, append(data, 'x')))
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "xxxxxxxxxx", string(data))
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// no temporary file is left behind
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+}
@@ -0,0 +1,143 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"awssh/internal/aws"
+)
+
+// unsafeChars are the characters not allowed in an Ansible group name
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Options of the connection variables of the inventory hosts.
+// The ProxyCommand is the ssh ProxyCommand of the hosts, followed by the instance-id and the '%p' port of each host
+type Options struct {
+	User         string
+	Port         int
+	UsePublicIP  bool
+	ProxyCommand string
+}
+
+// Group represent an Ansible inventory group
+type Group struct {
+	Hosts    []string `json:"hosts,omitempty"`
+	Children []string `json:"children,omitempty"`
+}
+
+// Meta represent the '_meta' of an Ansible dynamic inventory, having the variables of every host
+type Meta struct {
+	HostVars map[string]HostVars `json:"hostvars"`
+}
+
+// HostVars represent the variables of an inventory host, the connection variables followed by the EC2 attributes
+type HostVars struct {
+	AnsibleHost string `json:"ansible_host"`
+	AnsibleUser string `json:"ansible_user"`
+	AnsiblePort int    `json:"ansible_port"`
+
+	AnsibleSSHCommonArgs string `json:"ansible_ssh_common_args,omitempty"`
+
+	InstanceID       string            `json:"ec2_instance_id"`
+	Name             string            `json:"ec2_name"`
+	InstanceType     string            `json:"ec2_instance_type"`
+	AvailabilityZone string            `json:"ec2_availability_zone"`
+	PrivateIP        string            `json:"ec2_private_ip"`
+	PublicIP         string            `json:"ec2_public_ip,omitempty"`
+	Tags             map[string]string `json:"ec2_tags"`
+}
+
+// Inventory represent an Ansible dynamic inventory, as the output of 'ansible-inventory --list'
+type Inventory struct {
+	Groups map[string]*Group
+	Meta   Meta
+}
+
+// New creates an Inventory of the EC2 instances keyed by the instance-id, grouped by each tag key and value,
+// the availability zone and the instance type, e.g. tag_Environment_staging, az_ap_southeast_1a and type_t3_micro.
+// The instances without the address to connect to are left out, i.e. without a public IP when it is used
+func New(instances []*aws.Instance, opts Options) *Inventory {
+	inventory := &Inventory{
+		Groups: make(map[string]*Group),
+		Meta: Meta{
+			HostVars: make(map[string]HostVars),
+		},
+	}
+
+	for _, instance := range instances {
+		address := instance.PrivateIP
+		if opts.UsePublicIP {
+			address = instance.PublicIP
+		}
+		if address == "" {
+			continue
+		}
+
+		hostVars := HostVars{
+			AnsibleHost:      address,
+			AnsibleUser:      opts.User,
+			AnsiblePort:      opts.Port,
+			InstanceID:       instance.InstanceID,
+			Name:             instance.Name,
+			InstanceType:     instance.InstanceType,
+			AvailabilityZone: instance.AvailabilityZone,
+			PrivateIP:        instance.PrivateIP,
+			PublicIP:         instance.PublicIP,
+			Tags:             instance.Tags,
+		}
+		if opts.ProxyCommand != "" {
+			hostVars.AnsibleSSHCommonArgs = fmt.Sprintf(`-o ProxyCommand="%s %s %%p"`, opts.ProxyCommand, instance.InstanceID)
+		}
+		inventory.Meta.HostVars[instance.InstanceID] = hostVars
+
+		for key, value := range instance.Tags {
+			inventory.add(GroupName("tag", key, value), instance.InstanceID)
+		}
+		if instance.AvailabilityZone != "" {
+			inventory.add(GroupName("az", instance.AvailabilityZone), instance.InstanceID)
+		}
+		if instance.InstanceType != "" {
+			inventory.add(GroupName("type", instance.InstanceType), instance.InstanceID)
+		}
+	}
+
+	children := make([]string, 0, len(inventory.Groups))
+	for name, group := range inventory.Groups {
+		sort.Strings(group.Hosts)
+		children = append(children, name)
+	}
+	sort.Strings(children)
+
+	inventory.Groups["all"] = &Group{Children: children}
+
+	return inventory
+}
+
+// MarshalJSON encodes the inventory into the Ansible dynamic inventory JSON, the groups along with the '_meta'
+func (i *Inventory) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{}, len(i.Groups)+1)
+	for name, group := range i.Groups {
+		out[name] = group
+	}
+	out["_meta"] = i.Meta
+
+	return json.Marshal(out)
+}
+
+// add adds the host into the group, the group is created when it does not exist
+func (i *Inventory) add(name, host string) {
+	group, ok := i.Groups[name]
+	if !ok {
+		group = &Group{}
+		i.Groups[name] = group
+	}
+	group.Hosts = append(group.Hosts, host)
+}
+
+// GroupName joins the parts into an Ansible group name, replacing the characters not allowed with an underscore
+func GroupName(parts ...string) string {
+	return unsafeChars.ReplaceAllString(strings.Join(parts, "_"), "_")
+}
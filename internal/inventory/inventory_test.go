@@ -0,0 +1,90 @@
+package inventory_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"awssh/internal/aws"
+	. "awssh/internal/inventory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInventory(t *testing.T) {
+	instances := []*aws.Instance{
+		{
+			Name:             "jenkins-master",
+			InstanceID:       "i-0387e016c47c6170c",
+			PrivateIP:        "10.0.1.10",
+			PublicIP:         "54.1.2.3",
+			AvailabilityZone: "ap-southeast-1a",
+			InstanceType:     "t3.micro",
+			Tags:             map[string]string{"Name": "jenkins-master", "Environment": "staging"},
+		},
+		{
+			Name:             "jenkins-agent",
+			InstanceID:       "i-0b22a22eec53b9321",
+			PrivateIP:        "10.0.2.10",
+			AvailabilityZone: "ap-southeast-1b",
+			InstanceType:     "t3.micro",
+			Tags:             map[string]string{"Name": "jenkins-agent", "Environment": "staging"},
+		},
+	}
+
+	t.Run("private IP", func(t *testing.T) {
+		inventory := New(instances, Options{User: "ec2-user", Port: 22})
+
+		out, err := json.Marshal(inventory)
+		assert.Nil(t, err)
+
+		var decoded map[string]json.RawMessage
+		assert.Nil(t, json.Unmarshal(out, &decoded))
+		assert.Contains(t, decoded, "_meta")
+
+		assert.Equal(t, []string{"i-0387e016c47c6170c", "i-0b22a22eec53b9321"}, inventory.Groups["tag_Environment_staging"].Hosts)
+		assert.Equal(t, []string{"i-0387e016c47c6170c"}, inventory.Groups["tag_Name_jenkins_master"].Hosts)
+		assert.Equal(t, []string{"i-0b22a22eec53b9321"}, inventory.Groups["az_ap_southeast_1b"].Hosts)
+		assert.Equal(t, []string{"i-0387e016c47c6170c", "i-0b22a22eec53b9321"}, inventory.Groups["type_t3_micro"].Hosts)
+		assert.Equal(t, []string{
+			"az_ap_southeast_1a",
+			"az_ap_southeast_1b",
+			"tag_Environment_staging",
+			"tag_Name_jenkins_agent",
+			"tag_Name_jenkins_master",
+			"type_t3_micro",
+		}, inventory.Groups["all"].Children)
+
+		hostVars := inventory.Meta.HostVars["i-0387e016c47c6170c"]
+		assert.Equal(t, "10.0.1.10", hostVars.AnsibleHost)
+		assert.Equal(t, "ec2-user", hostVars.AnsibleUser)
+		assert.Equal(t, 22, hostVars.AnsiblePort)
+		assert.Equal(t, "jenkins-master", hostVars.Name)
+		assert.Empty(t, hostVars.AnsibleSSHCommonArgs)
+	})
+
+	t.Run("proxy command", func(t *testing.T) {
+		inventory := New(instances, Options{User: "ec2-user", Port: 22, ProxyCommand: "/usr/local/bin/awssh proxy --region ap-southeast-1 --ssh-username %r"})
+
+		assert.Equal(t, `-o ProxyCommand="/usr/local/bin/awssh proxy --region ap-southeast-1 --ssh-username %r i-0b22a22eec53b9321 %p"`,
+			inventory.Meta.HostVars["i-0b22a22eec53b9321"].AnsibleSSHCommonArgs)
+	})
+
+	t.Run("no instances", func(t *testing.T) {
+		out, err := json.Marshal(New(nil, Options{User: "ec2-user", Port: 22}))
+		assert.Nil(t, err)
+		assert.JSONEq(t, `{"_meta":{"hostvars":{}},"all":{}}`, string(out))
+	})
+
+	t.Run("public IP", func(t *testing.T) {
+		inventory := New(instances, Options{User: "ubuntu", Port: 2222, UsePublicIP: true})
+
+		assert.Len(t, inventory.Meta.HostVars, 1)
+		assert.Equal(t, "54.1.2.3", inventory.Meta.HostVars["i-0387e016c47c6170c"].AnsibleHost)
+		assert.Equal(t, []string{"i-0387e016c47c6170c"}, inventory.Groups["tag_Environment_staging"].Hosts)
+	})
+}
+
+func TestGroupName(t *testing.T) {
+	assert.Equal(t, "tag_kubernetes_io_cluster_production_owned", GroupName("tag", "kubernetes.io/cluster/production", "owned"))
+	assert.Equal(t, "type_m5_large", GroupName("type", "m5.large"))
+}
@@ -0,0 +1,115 @@
+package keypush
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"awssh/internal/errdefs"
+	"awssh/internal/filelock"
+)
+
+// Cache is a local state file of the ssh public keys pushed with EC2 Instance Connect,
+// used to skip re-pushing a key to the instance while the pushed one is still valid
+type Cache struct {
+	Path   string
+	Window time.Duration
+
+	now func() time.Time
+}
+
+// Push represent an ssh public key pushed to the instance for the OS user
+type Push struct {
+	InstanceID  string    `json:"instance_id"`
+	OSUser      string    `json:"os_user"`
+	Fingerprint string    `json:"fingerprint"`
+	PushedAt    time.Time `json:"pushed_at"`
+}
+
+type cacheFile struct {
+	Pushes []Push `json:"pushes"`
+}
+
+// NewCache creates a new Cache of the state file, a pushed key is considered valid within the window
+func NewCache(path string, window time.Duration) *Cache {
+	return &Cache{
+		Path:   path,
+		Window: window,
+		now:    time.Now,
+	}
+}
+
+// Valid reports whether the key is pushed to the instance for the OS user within the window
+func (c *Cache) Valid(instanceID, osUser, fingerprint string) bool {
+	for _, push := range c.load() {
+		if push.InstanceID == instanceID && push.OSUser == osUser && push.Fingerprint == fingerprint {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Record records the key is pushed to the instance for the OS user now, the pushes out of the window are dropped.
+// The cache is locked while it is updated, so the pushes recorded by the concurrent awssh processes are kept
+func (c *Cache) Record(instanceID, osUser, fingerprint string) error {
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0700); err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to create key push cache directory")
+	}
+
+	unlock, err := filelock.Lock(c.Path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock() // nolint: errcheck
+
+	pushes := []Push{{
+		InstanceID:  instanceID,
+		OSUser:      osUser,
+		Fingerprint: fingerprint,
+		PushedAt:    c.now(),
+	}}
+
+	for _, push := range c.load() {
+		if push.InstanceID == instanceID && push.OSUser == osUser && push.Fingerprint == fingerprint {
+			continue
+		}
+		pushes = append(pushes, push)
+	}
+
+	data, err := json.Marshal(cacheFile{Pushes: pushes})
+	if err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to encode key push cache")
+	}
+
+	// written into a temporary file first, so a concurrent awssh never reads a partial cache
+	if err := filelock.WriteFile(c.Path, data); err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to write key push cache")
+	}
+
+	return nil
+}
+
+// load get the pushes within the window, a missing or corrupted cache has none
+func (c *Cache) load() []Push {
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		return nil
+	}
+
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil
+	}
+
+	now := c.now()
+	pushes := make([]Push, 0, len(file.Pushes))
+	for _, push := range file.Pushes {
+		if age := now.Sub(push.PushedAt); age >= 0 && age < c.Window {
+			pushes = append(pushes, push)
+		}
+	}
+
+	return pushes
+}
@@ -0,0 +1,71 @@
+package keypush
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Date(2020, 9, 7, 5, 24, 52, 0, time.UTC)
+
+	c := NewCache(filepath.Join(t.TempDir(), "cache", "pushed-keys.json"), 45*time.Second)
+	c.now = func() time.Time { return now }
+
+	t.Run("missing cache", func(t *testing.T) {
+		assert.False(t, c.Valid("i-0387e016c47c6170c", "ec2-user", "SHA256:a"))
+	})
+
+	t.Run("valid within the window", func(t *testing.T) {
+		assert.Nil(t, c.Record("i-0387e016c47c6170c", "ec2-user", "SHA256:a"))
+
+		assert.True(t, c.Valid("i-0387e016c47c6170c", "ec2-user", "SHA256:a"))
+		assert.False(t, c.Valid("i-0387e016c47c6170c", "ubuntu", "SHA256:a"))
+		assert.False(t, c.Valid("i-0387e016c47c6170c", "ec2-user", "SHA256:b"))
+		assert.False(t, c.Valid("i-0b22a22eec53b9321", "ec2-user", "SHA256:a"))
+
+		now = now.Add(44 * time.Second)
+		assert.True(t, c.Valid("i-0387e016c47c6170c", "ec2-user", "SHA256:a"))
+
+		now = now.Add(time.Second)
+		assert.False(t, c.Valid("i-0387e016c47c6170c", "ec2-user", "SHA256:a"))
+	})
+
+	t.Run("expired pushes are dropped", func(t *testing.T) {
+		assert.Nil(t, c.Record("i-0b22a22eec53b9321", "ec2-user", "SHA256:a"))
+
+		data, err := os.ReadFile(c.Path)
+		assert.Nil(t, err)
+
+		var file cacheFile
+		assert.Nil(t, json.Unmarshal(data, &file))
+		assert.Len(t, file.Pushes, 1)
+		assert.Equal(t, "i-0b22a22eec53b9321", file.Pushes[0].InstanceID)
+	})
+
+	t.Run("concurrent records are kept", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for _, instanceID := range []string{"i-00000000000000001", "i-00000000000000002", "i-00000000000000003", "i-00000000000000004"} {
+			wg.Add(1)
+			go func(instanceID string) {
+				defer wg.Done()
+				assert.Nil(t, NewCache(c.Path, c.Window).Record(instanceID, "ec2-user", "SHA256:a"))
+			}(instanceID)
+		}
+		wg.Wait()
+
+		for _, instanceID := range []string{"i-00000000000000001", "i-00000000000000002", "i-00000000000000003", "i-00000000000000004"} {
+			assert.True(t, NewCache(c.Path, c.Window).Valid(instanceID, "ec2-user", "SHA256:a"))
+		}
+	})
+
+	t.Run("corrupted cache is treated as missing", func(t *testing.T) {
+		assert.Nil(t, os.WriteFile(c.Path, []byte("{"), 0600))
+		assert.False(t, c.Valid("i-0b22a22eec53b9321", "ec2-user", "SHA256:a"))
+	})
+}
@@ -1,42 +1,127 @@
 package logging
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
+	zaplogfmt "github.com/jsternberg/zap-logfmt"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/term"
+
+	"awssh/internal/errdefs"
+)
+
+// Log output formats
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+	FormatLogfmt  = "logfmt"
 )
 
+// Options represent the application logger configuration
+type Options struct {
+	// Format is the log output format, either console, json or logfmt
+	Format string
+	// Level is the minimum enabled log level, e.g. debug, info, warn, error
+	Level string
+	// File is an optional file path to write the logs in addition to stderr
+	File string
+	// Debug enables the debug level regardless of the Level
+	Debug bool
+}
+
 var appLogger *zap.SugaredLogger
 
 // NewLogger used to initialize the application logger
-func NewLogger(debugMode bool) *zap.SugaredLogger {
-	var level zapcore.Level
-
-	switch debugMode {
-	case true:
+// All of the logs are written to stderr, so the stdout is reserved for the command output.
+// When the options are invalid, the logger is still initialized with the defaults and the error is returned
+func NewLogger(opts Options) (*zap.SugaredLogger, error) {
+	level, err := parseLevel(opts.Level)
+	if opts.Debug {
 		level = zapcore.DebugLevel
-	default:
-		level = zapcore.InfoLevel
 	}
 
-	cfg := zap.Config{
-		Encoding:         "console",
-		Level:            zap.NewAtomicLevelAt(level),
-		OutputPaths:      []string{"stdout"},
-		ErrorOutputPaths: []string{"stderr"},
-		EncoderConfig: zapcore.EncoderConfig{
+	format := opts.Format
+	if format == "" {
+		format = FormatConsole
+	}
+
+	stderrEncoder, formatErr := newEncoder(format, term.IsTerminal(int(os.Stderr.Fd())))
+	if formatErr != nil {
+		format = FormatConsole
+		stderrEncoder, _ = newEncoder(format, false)
+		err = formatErr
+	}
+
+	cores := []zapcore.Core{
+		zapcore.NewCore(stderrEncoder, zapcore.Lock(os.Stderr), level),
+	}
+
+	if opts.File != "" {
+		f, fileErr := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if fileErr != nil {
+			err = fmt.Errorf("awssh: unable to open log file: (%v)", fileErr)
+		} else {
+			fileEncoder, _ := newEncoder(format, false)
+			cores = append(cores, zapcore.NewCore(fileEncoder, zapcore.Lock(f), level))
+		}
+	}
+
+	appLogger = zap.New(zapcore.NewTee(cores...)).Sugar()
+	defer appLogger.Sync() // nolint: errcheck
+
+	return appLogger, err
+}
+
+// newEncoder creates a log encoder for the format,
+// the colored level is only used by the console format on a terminal
+func newEncoder(format string, colored bool) (zapcore.Encoder, error) {
+	switch format {
+	case FormatConsole:
+		levelEncoder := zapcore.CapitalLevelEncoder
+		if colored {
+			levelEncoder = zapcore.CapitalColorLevelEncoder
+		}
+
+		return zapcore.NewConsoleEncoder(zapcore.EncoderConfig{
 			MessageKey:  "message",
-			EncodeLevel: zapcore.CapitalColorLevelEncoder,
+			EncodeLevel: levelEncoder,
 			LevelKey:    "key",
-		},
+		}), nil
+	case FormatJSON:
+		return zapcore.NewJSONEncoder(structuredEncoderConfig()), nil
+	case FormatLogfmt:
+		return zaplogfmt.NewEncoder(structuredEncoderConfig()), nil
+	default:
+		return nil, fmt.Errorf("awssh: unknown log format '%s', must be one of: console, json, logfmt", format)
 	}
+}
 
-	logger, _ := cfg.Build()
-	appLogger = logger.Sugar()
-	defer appLogger.Sync() // nolint: errcheck
+func structuredEncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "level",
+		MessageKey:     "msg",
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	}
+}
 
-	return appLogger
+func parseLevel(level string) (zapcore.Level, error) {
+	var l zapcore.Level
+
+	if level == "" {
+		return zapcore.InfoLevel, nil
+	}
+
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return zapcore.InfoLevel, fmt.Errorf("awssh: unknown log level '%s'", level)
+	}
+
+	return l, nil
 }
 
 // Logger used to get the application logger
@@ -45,9 +130,17 @@ func Logger() *zap.SugaredLogger {
 }
 
 // ExitWithError will terminate execution with an error result
-// It prints the error to stderr and exits with a non-zero exit code
+// It prints the error to stderr and exits with the exit code of the error kind,
+// the exit status of the remote ssh command is passed through unchanged
 func ExitWithError(err error) {
 	defer appLogger.Sync() // nolint: errcheck
-	appLogger.Error(err)
-	os.Exit(1)
+
+	var exitErr *errdefs.ExitError
+	if errors.As(err, &exitErr) {
+		appLogger.Debug(err)
+	} else {
+		appLogger.Error(err)
+	}
+
+	os.Exit(errdefs.ExitCode(err))
 }
@@ -0,0 +1,89 @@
+package rdp
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"awssh/internal/errdefs"
+)
+
+// DefaultPort is the RDP port of the Windows instances
+const DefaultPort = 3389
+
+// DecryptPassword decrypts the base64 encoded administrator password data of a Windows instance
+// with the PEM encoded RSA private key of the key pair the instance is launched with
+func DecryptPassword(passwordData string, privateKeyPEM []byte) (string, error) {
+	privateKey, err := parsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(strings.TrimSpace(passwordData))
+	if err != nil {
+		return "", errdefs.Wrap(errdefs.ErrInvalidArgs, err, "malformed password data")
+	}
+
+	password, err := rsa.DecryptPKCS1v15(nil, privateKey, encrypted)
+	if err != nil {
+		return "", errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to decrypt password, the private key does not match the key pair of the instance")
+	}
+
+	return string(password), nil
+}
+
+func parsePrivateKey(privateKeyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errdefs.New(errdefs.ErrInvalidArgs, "invalid private key, expecting a PEM encoded RSA private key")
+	}
+
+	if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return privateKey, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrInvalidArgs, err, "invalid private key")
+	}
+
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errdefs.New(errdefs.ErrInvalidArgs, "invalid private key, the Windows password is only encrypted with an RSA key pair")
+	}
+
+	return privateKey, nil
+}
+
+// File represent an .rdp connection file
+type File struct {
+	Address  string
+	Port     int
+	Username string
+}
+
+// Write writes the rdp file, the password is prompted by the RDP client
+func (f File) Write(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to create rdp file directory")
+	}
+
+	lines := []string{
+		fmt.Sprintf("full address:s:%s:%d", f.Address, f.Port),
+		fmt.Sprintf("username:s:%s", f.Username),
+		"prompt for credentials:i:1",
+		"administrative session:i:1",
+		"",
+	}
+
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")), 0600); err != nil {
+		return errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to write rdp file")
+	}
+
+	return nil
+}
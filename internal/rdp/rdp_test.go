@@ -0,0 +1,65 @@
+package rdp_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"awssh/internal/errdefs"
+	. "awssh/internal/rdp"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecryptPassword(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, &privateKey.PublicKey, []byte("s3cr3t-P@ssw0rd"))
+	assert.Nil(t, err)
+	passwordData := base64.StdEncoding.EncodeToString(encrypted)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.Nil(t, err)
+
+	for name, privateKeyPEM := range map[string][]byte{
+		"pkcs1": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}),
+		"pkcs8": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			password, err := DecryptPassword("\n"+passwordData+"\n", privateKeyPEM)
+			assert.Nil(t, err)
+			assert.Equal(t, "s3cr3t-P@ssw0rd", password)
+		})
+	}
+
+	t.Run("mismatch private key", func(t *testing.T) {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.Nil(t, err)
+
+		_, err = DecryptPassword(passwordData, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(otherKey)}))
+		assert.True(t, errors.Is(err, errdefs.ErrInvalidArgs))
+	})
+
+	t.Run("invalid private key", func(t *testing.T) {
+		_, err := DecryptPassword(passwordData, []byte("ssh-ed25519 AAAA"))
+		assert.True(t, errors.Is(err, errdefs.ErrInvalidArgs))
+	})
+}
+
+func TestFileWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rdp", "i-0387e016c47c6170c.rdp")
+
+	file := File{Address: "localhost", Port: 33389, Username: "Administrator"}
+	assert.Nil(t, file.Write(path))
+
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "full address:s:localhost:33389\r\nusername:s:Administrator\r\nprompt for credentials:i:1\r\nadministrative session:i:1\r\n", string(content))
+}
@@ -0,0 +1,186 @@
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Header represent an asciicast v2 header
+// ref: https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Session   *SessionInfo      `json:"awssh,omitempty"`
+}
+
+// SessionInfo represent the awssh session metadata recorded in the asciicast header
+type SessionInfo struct {
+	InstanceID   string `json:"instance_id"`
+	InstanceName string `json:"instance_name"`
+	User         string `json:"user"`
+	Region       string `json:"region"`
+}
+
+// Event represent an asciicast v2 event, i.e. [time, type, data]
+type Event struct {
+	Time float64
+	Type string
+	Data string
+}
+
+// MarshalJSON encodes an Event as an asciicast v2 event array
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Time, e.Type, e.Data})
+}
+
+// UnmarshalJSON decodes an Event from an asciicast v2 event array
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var raw []interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if len(raw) != 3 {
+		return fmt.Errorf("awssh: bad asciicast event: %s", string(data))
+	}
+
+	t, ok1 := raw[0].(float64)
+	typ, ok2 := raw[1].(string)
+	d, ok3 := raw[2].(string)
+	if !ok1 || !ok2 || !ok3 {
+		return fmt.Errorf("awssh: bad asciicast event: %s", string(data))
+	}
+
+	e.Time, e.Type, e.Data = t, typ, d
+	return nil
+}
+
+// Recorder used to record a terminal stream into an asciicast v2 file
+type Recorder struct {
+	mu      sync.Mutex
+	w       io.Writer
+	start   time.Time
+	now     func() time.Time
+	streams []*Stream
+
+	// the default stream written with Write
+	output *Stream
+}
+
+// Stream used to record an output stream of the terminal, e.g. the stdout or the stderr, as asciicast "o" events.
+// An incomplete UTF-8 sequence at the end of a write is held in the stream until its next write,
+// so a write of another stream is never recorded in the middle of a character
+type Stream struct {
+	r       *Recorder
+	pending []byte
+}
+
+// NewRecorder creates a new Recorder and writes the asciicast header
+func NewRecorder(w io.Writer, header Header) (*Recorder, error) {
+	return newRecorder(w, header, time.Now)
+}
+
+func newRecorder(w io.Writer, header Header, now func() time.Time) (*Recorder, error) {
+	start := now()
+
+	header.Version = 2
+	if header.Timestamp == 0 {
+		header.Timestamp = start.Unix()
+	}
+
+	if err := json.NewEncoder(w).Encode(header); err != nil {
+		return nil, fmt.Errorf("awssh: unable to write asciicast header: (%v)", err)
+	}
+
+	r := &Recorder{
+		w:     w,
+		start: start,
+		now:   now,
+	}
+	r.output = r.Stream()
+
+	return r, nil
+}
+
+// Stream creates a new output Stream of the recorder
+func (r *Recorder) Stream() *Stream {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stream := &Stream{r: r}
+	r.streams = append(r.streams, stream)
+	return stream
+}
+
+// Write records the output into the default stream of the recorder
+func (r *Recorder) Write(p []byte) (int, error) {
+	return r.output.Write(p)
+}
+
+// Close records the incomplete UTF-8 sequences still held by the streams, as the session has ended
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stream := range r.streams {
+		if len(stream.pending) == 0 {
+			continue
+		}
+
+		if err := r.writeEvent("o", stream.pending); err != nil {
+			return err
+		}
+		stream.pending = nil
+	}
+
+	return nil
+}
+
+// Write records the output stream as an asciicast "o" event
+// An incomplete UTF-8 sequence at the end of p is held until the next write
+func (s *Stream) Write(p []byte) (int, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+
+	data := append(s.pending, p...)
+
+	n := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				n = i
+			}
+			break
+		}
+	}
+
+	s.pending = append([]byte{}, data[n:]...)
+	if n == 0 {
+		return len(p), nil
+	}
+
+	if err := s.r.writeEvent("o", data[:n]); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (r *Recorder) writeEvent(typ string, p []byte) error {
+	event := Event{
+		Time: r.now().Sub(r.start).Seconds(),
+		Type: typ,
+		Data: string(p),
+	}
+
+	return json.NewEncoder(r.w).Encode(event)
+}
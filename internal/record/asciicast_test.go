@@ -0,0 +1,77 @@
+package record
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	clock := start
+	now := func() time.Time { return clock }
+
+	buf := &bytes.Buffer{}
+	rec, err := newRecorder(buf, Header{
+		Width:  80,
+		Height: 24,
+		Session: &SessionInfo{
+			InstanceID: "i-1234567890",
+			User:       "ec2-user",
+			Region:     "ap-southeast-1",
+		},
+	}, now)
+	assert.Nil(t, err)
+
+	clock = start.Add(500 * time.Millisecond)
+	_, err = rec.Write([]byte("hello "))
+	assert.Nil(t, err)
+
+	// "é" split across two writes is recorded as a single event
+	clock = start.Add(2 * time.Second)
+	_, _ = rec.Write([]byte{0xc3})
+	_, _ = rec.Write([]byte{0xa9})
+
+	// the stderr written in the middle of a character of the stdout is recorded on its own
+	stdout, stderr := rec.Stream(), rec.Stream()
+	clock = start.Add(3 * time.Second)
+	_, _ = stdout.Write([]byte{0xe2, 0x9c})
+	_, _ = stderr.Write([]byte("!"))
+	_, _ = stdout.Write([]byte{0x93})
+
+	// the incomplete character at the end of the session is still recorded
+	clock = start.Add(4 * time.Second)
+	_, _ = stdout.Write([]byte{0xf0, 0x9f})
+	assert.Nil(t, rec.Close())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 6)
+	assert.Equal(t, `{"version":2,"width":80,"height":24,"timestamp":1600000000,"awssh":{"instance_id":"i-1234567890","instance_name":"","user":"ec2-user","region":"ap-southeast-1"}}`, lines[0])
+	assert.Equal(t, `[0.5,"o","hello "]`, lines[1])
+	assert.Equal(t, `[2,"o","é"]`, lines[2])
+	assert.Equal(t, `[3,"o","!"]`, lines[3])
+	assert.Equal(t, `[3,"o","✓"]`, lines[4])
+	assert.Equal(t, "[4,\"o\",\"\ufffd\ufffd\"]", lines[5])
+
+	t.Run("replay the recording", func(t *testing.T) {
+		slept := time.Duration(0)
+		player := NewPlayer(2, time.Second)
+		player.sleep = func(d time.Duration) { slept += d }
+
+		out := &bytes.Buffer{}
+		header, err := player.Play(bytes.NewReader(buf.Bytes()), out)
+		assert.Nil(t, err)
+		assert.Equal(t, "i-1234567890", header.Session.InstanceID)
+		assert.Equal(t, "hello é!✓\ufffd\ufffd", out.String())
+		// 0.5s + 1.5s capped to 1s by idle time limit + 1s + 1s, played at 2x speed
+		assert.Equal(t, 1750*time.Millisecond, slept)
+	})
+
+	t.Run("replay unsupported recording", func(t *testing.T) {
+		_, err := NewPlayer(1, 0).Play(strings.NewReader(`{"version":1}`), &bytes.Buffer{})
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,87 @@
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Player used to play back an asciicast v2 file
+type Player struct {
+	// Speed is the playback speed multiplier, e.g. 2 to play twice as fast
+	Speed float64
+	// IdleTimeLimit limits the idle time between events, zero means no limit
+	IdleTimeLimit time.Duration
+
+	sleep func(time.Duration)
+}
+
+// NewPlayer creates a new Player with the playback speed and idle time limit
+func NewPlayer(speed float64, idleTimeLimit time.Duration) *Player {
+	if speed <= 0 {
+		speed = 1
+	}
+
+	return &Player{
+		Speed:         speed,
+		IdleTimeLimit: idleTimeLimit,
+		sleep:         time.Sleep,
+	}
+}
+
+// Play reads the asciicast v2 recording from r and writes the output events to w
+// following the recorded timing, it returns the recording header
+func (p *Player) Play(r io.Reader, w io.Writer) (*Header, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("awssh: empty asciicast recording")
+	}
+
+	var header Header
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, fmt.Errorf("awssh: bad asciicast header: (%v)", err)
+	}
+
+	if header.Version != 2 {
+		return nil, fmt.Errorf("awssh: unsupported asciicast version: %d", header.Version)
+	}
+
+	var last float64
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, err
+		}
+
+		delay := time.Duration((event.Time - last) * float64(time.Second))
+		if p.IdleTimeLimit > 0 && delay > p.IdleTimeLimit {
+			delay = p.IdleTimeLimit
+		}
+		last = event.Time
+
+		if delay > 0 {
+			p.sleep(time.Duration(float64(delay) / p.Speed))
+		}
+
+		if event.Type != "o" {
+			continue
+		}
+
+		if _, err := io.WriteString(w, event.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	return &header, scanner.Err()
+}
@@ -0,0 +1,70 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HostConfig represent a Host block of an ssh_config file
+type HostConfig struct {
+	Host                  string
+	HostName              string
+	User                  string
+	Port                  string
+	HostKeyAlias          string
+	UserKnownHostsFile    string
+	StrictHostKeyChecking string
+	ControlMaster         string
+	ControlPath           string
+	ControlPersist        string
+}
+
+// WriteConfig writes an ssh_config(5) file with a Host block for each of the hosts,
+// followed by the user ssh config, so the options of the user still apply to the rest of the hosts
+func WriteConfig(path string, hosts []HostConfig) error {
+	var b strings.Builder
+
+	for _, host := range hosts {
+		fmt.Fprintf(&b, "Host %s\n", host.Host)
+		for _, option := range [][2]string{
+			{"HostName", host.HostName},
+			{"User", host.User},
+			{"Port", host.Port},
+			{"HostKeyAlias", host.HostKeyAlias},
+			{"UserKnownHostsFile", host.UserKnownHostsFile},
+			{"StrictHostKeyChecking", host.StrictHostKeyChecking},
+			{"ControlMaster", host.ControlMaster},
+			{"ControlPath", host.ControlPath},
+			{"ControlPersist", host.ControlPersist},
+		} {
+			if option[1] != "" {
+				fmt.Fprintf(&b, "  %s %s\n", option[0], configValue(option[1]))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	// ssh(1) reads no user config once -F is given, a missing file is ignored by the Include
+	b.WriteString("Match all\n")
+	b.WriteString("  Include ~/.ssh/config\n")
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("awssh: unable to create ssh config directory: (%v)", err)
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("awssh: unable to write ssh config file: (%v)", err)
+	}
+
+	return nil
+}
+
+// configValue double-quotes the ssh_config value having whitespaces
+func configValue(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
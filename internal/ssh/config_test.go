@@ -0,0 +1,61 @@
+package ssh_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "awssh/internal/ssh"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wrap", "ssh_config")
+
+	err := WriteConfig(path, []HostConfig{
+		{
+			Host:                  "i-0387e016c47c6170c",
+			HostName:              "10.0.1.10",
+			User:                  "ec2-user",
+			Port:                  "22",
+			HostKeyAlias:          "i-0387e016c47c6170c",
+			UserKnownHostsFile:    "/home/awssh/My Documents/known_hosts",
+			StrictHostKeyChecking: "yes",
+		},
+		{
+			Host:           "i-0b22a22eec53b9321",
+			HostName:       "10.0.1.11",
+			User:           "ubuntu",
+			ControlMaster:  "auto",
+			ControlPath:    "/run/user/1000/awssh/%r@i-0b22a22eec53b9321:%p.sock",
+			ControlPersist: "600s",
+		},
+	})
+	assert.Nil(t, err)
+
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, `Host i-0387e016c47c6170c
+  HostName 10.0.1.10
+  User ec2-user
+  Port 22
+  HostKeyAlias i-0387e016c47c6170c
+  UserKnownHostsFile "/home/awssh/My Documents/known_hosts"
+  StrictHostKeyChecking yes
+
+Host i-0b22a22eec53b9321
+  HostName 10.0.1.11
+  User ubuntu
+  ControlMaster auto
+  ControlPath /run/user/1000/awssh/%r@i-0b22a22eec53b9321:%p.sock
+  ControlPersist 600s
+
+Match all
+  Include ~/.ssh/config
+`, string(content))
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
@@ -0,0 +1,180 @@
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"awssh/internal/filelock"
+)
+
+// KnownHosts represent an awssh-managed known_hosts file
+// where each entry is keyed by the EC2 instance-id (used as ssh HostKeyAlias)
+type KnownHosts struct {
+	Path string
+}
+
+// NewKnownHosts creates a new KnownHosts from a file path,
+// it also makes sure the parent directory of the file is exist
+func NewKnownHosts(path string) (*KnownHosts, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("awssh: unable to create known_hosts directory: (%v)", err)
+	}
+
+	return &KnownHosts{
+		Path: path,
+	}, nil
+}
+
+// Lookup returns all of the host keys recorded for the host alias
+func (k *KnownHosts) Lookup(alias string) ([]string, error) {
+	lines, err := k.read()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0)
+	for _, line := range lines {
+		host, key, ok := splitKnownHostsLine(line)
+		if ok && host == alias {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// Changed reports whether the host keys of the host alias are recorded and mismatch with the given keys
+func (k *KnownHosts) Changed(alias string, hostKeys []string) (bool, error) {
+	newKeys, err := normalizeHostKeys(hostKeys)
+	if err != nil {
+		return false, err
+	}
+
+	oldKeys, err := k.Lookup(alias)
+	if err != nil {
+		return false, err
+	}
+
+	return len(oldKeys) > 0 && !sameKeys(oldKeys, newKeys), nil
+}
+
+// Update replaces the recorded host keys of the host alias with the given keys.
+// The file is rewritten under a lock through a temporary file, as the concurrent awssh processes share it
+func (k *KnownHosts) Update(alias string, hostKeys []string) error {
+	newKeys, err := normalizeHostKeys(hostKeys)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := filelock.Lock(k.Path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock() // nolint: errcheck
+
+	lines, err := k.read()
+	if err != nil {
+		return err
+	}
+
+	out := make([]string, 0, len(lines)+len(newKeys))
+	for _, line := range lines {
+		if host, _, ok := splitKnownHostsLine(line); ok && host == alias {
+			continue
+		}
+		out = append(out, line)
+	}
+
+	for _, key := range newKeys {
+		out = append(out, fmt.Sprintf("%s %s", alias, key))
+	}
+
+	if err := filelock.WriteFile(k.Path, []byte(strings.Join(out, "\n")+"\n")); err != nil {
+		return fmt.Errorf("awssh: unable to write known_hosts file: (%v)", err)
+	}
+
+	return nil
+}
+
+func (k *KnownHosts) read() ([]string, error) {
+	f, err := os.Open(k.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("awssh: unable to read known_hosts file: (%v)", err)
+	}
+	defer f.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// normalizeHostKeys normalize each of the authorized_keys formatted host keys
+func normalizeHostKeys(hostKeys []string) ([]string, error) {
+	keys := make([]string, 0, len(hostKeys))
+	for _, hostKey := range hostKeys {
+		key, err := normalizeHostKey(hostKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// normalizeHostKey parse an authorized_keys formatted host key
+// and return it as "<type> <base64>" without any comment
+func normalizeHostKey(hostKey string) (string, error) {
+	pub, _, _, _, err := gossh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return "", fmt.Errorf("awssh: invalid host key '%s': (%v)", hostKey, err)
+	}
+
+	return strings.TrimSpace(string(gossh.MarshalAuthorizedKey(pub))), nil
+}
+
+func splitKnownHostsLine(line string) (host string, key string, ok bool) {
+	if strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return "", "", false
+	}
+
+	return fields[0], fields[1] + " " + fields[2], true
+}
+
+func sameKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	x := append([]string{}, a...)
+	y := append([]string{}, b...)
+	sort.Strings(x)
+	sort.Strings(y)
+
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
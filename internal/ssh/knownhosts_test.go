@@ -0,0 +1,89 @@
+package ssh_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "awssh/internal/ssh"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	hostKeyA = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOzaY60WhT78A2KlT9OYB+yPzqOJlpjmG8R8EIMqPVqx"
+	hostKeyB = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAILl1RwT0Wtj4MibGf8VkQzdV5yF7tAw1QdqpGSQiIk4w"
+)
+
+func TestKnownHosts(t *testing.T) {
+	knownHosts, err := NewKnownHosts(filepath.Join(t.TempDir(), "awssh", "known_hosts"))
+	assert.Nil(t, err)
+
+	t.Run("first record", func(t *testing.T) {
+		changed, err := knownHosts.Changed("i-1234567890", []string{hostKeyA})
+		assert.Nil(t, err)
+		assert.False(t, changed)
+
+		assert.Nil(t, knownHosts.Update("i-1234567890", []string{hostKeyA + " root@host"}))
+
+		keys, err := knownHosts.Lookup("i-1234567890")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{hostKeyA}, keys)
+	})
+
+	t.Run("same host keys are not changed", func(t *testing.T) {
+		changed, err := knownHosts.Changed("i-1234567890", []string{hostKeyA + " root@host"})
+		assert.Nil(t, err)
+		assert.False(t, changed)
+	})
+
+	t.Run("changed host keys are replaced", func(t *testing.T) {
+		assert.Nil(t, knownHosts.Update("i-abcdef", []string{hostKeyA}))
+
+		changed, err := knownHosts.Changed("i-1234567890", []string{hostKeyB})
+		assert.Nil(t, err)
+		assert.True(t, changed)
+
+		changed, err = knownHosts.Changed("i-unknown", []string{hostKeyB})
+		assert.Nil(t, err)
+		assert.False(t, changed)
+
+		assert.Nil(t, knownHosts.Update("i-1234567890", []string{hostKeyB}))
+
+		keys, _ := knownHosts.Lookup("i-1234567890")
+		assert.Equal(t, []string{hostKeyB}, keys)
+
+		keys, _ = knownHosts.Lookup("i-abcdef")
+		assert.Equal(t, []string{hostKeyA}, keys)
+	})
+
+	t.Run("invalid host key", func(t *testing.T) {
+		assert.NotNil(t, knownHosts.Update("i-1234567890", []string{"ssh-ed25519 invalid"}))
+
+		_, err := knownHosts.Changed("i-1234567890", []string{"ssh-ed25519 invalid"})
+		assert.NotNil(t, err)
+
+		_, err = os.Stat(knownHosts.Path)
+		assert.Nil(t, err)
+	})
+
+	t.Run("concurrent updates", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				assert.Nil(t, knownHosts.Update(fmt.Sprintf("i-%d", i), []string{hostKeyA}))
+			}(i)
+		}
+		wg.Wait()
+
+		for i := 0; i < 10; i++ {
+			keys, err := knownHosts.Lookup(fmt.Sprintf("i-%d", i))
+			assert.Nil(t, err)
+			assert.Equal(t, []string{hostKeyA}, keys)
+		}
+	})
+}
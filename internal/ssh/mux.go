@@ -0,0 +1,160 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"awssh/internal/errdefs"
+)
+
+// controlSocketExt is the extension of the ControlMaster sockets managed by awssh
+const controlSocketExt = ".sock"
+
+// Master represent an ssh ControlMaster socket managed by awssh, named '<user>@<instance-id>:<port>.sock'
+type Master struct {
+	Path       string
+	InstanceID string
+	User       string
+	Port       string
+}
+
+// ControlPath get the ControlMaster socket of the instance for the user and port in the private runtime directory
+func ControlPath(dir, instanceID, user, port string) (string, error) {
+	if err := MakeRuntimeDir(dir); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("%s@%s:%s%s", user, instanceID, port, controlSocketExt)), nil
+}
+
+// MakeRuntimeDir creates the runtime directory of the ControlMaster sockets private to the user when it does not exist,
+// and makes it private when it is not, as anyone able to reach a socket can run commands through the authenticated connection
+func MakeRuntimeDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errdefs.Wrap(errdefs.ErrSSHFailure, err, "unable to create the runtime directory of the ControlMaster sockets")
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return errdefs.Wrap(errdefs.ErrSSHFailure, err, "unable to check the runtime directory of the ControlMaster sockets")
+	}
+
+	if !info.IsDir() {
+		return errdefs.New(errdefs.ErrSSHFailure, "the runtime directory of the ControlMaster sockets %s is not a directory", dir)
+	}
+
+	if info.Mode().Perm()&0077 == 0 {
+		return nil
+	}
+
+	if err := os.Chmod(dir, 0700); err != nil {
+		return errdefs.Wrap(errdefs.ErrSSHFailure, err, "the runtime directory of the ControlMaster sockets %s is accessible by other users (%s)", dir, info.Mode().Perm())
+	}
+
+	return nil
+}
+
+// ControlPathPattern get the ssh_config ControlPath of the instance, having the user and port
+// of the ssh connection expanded by ssh, i.e. the '%r' and '%p' tokens
+func ControlPathPattern(dir, instanceID string) string {
+	return filepath.Join(escapeTokens(dir), "%r@"+instanceID+":%p"+controlSocketExt)
+}
+
+// MuxOptions get the ssh options to multiplex the connections through the ControlMaster socket.
+// The first connection becomes the master, which persists in the background for the idle duration
+// after the last connection is closed, 0 means the master persists until it is closed
+func MuxOptions(controlPath string, persist time.Duration) []string {
+	return []string{
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=" + escapeTokens(controlPath),
+		"-o", fmt.Sprintf("ControlPersist=%ds", int(persist.Seconds())),
+	}
+}
+
+// CheckArgs get the ssh arguments asking the ControlMaster on the socket whether it is running,
+// ssh exits with 0 only when the master answers
+func CheckArgs(controlPath, host string) []string {
+	return []string{"-o", "ControlPath=" + escapeTokens(controlPath), "-O", "check", host}
+}
+
+// MasterRunning reports whether a ControlMaster is listening on the socket
+func MasterRunning(controlPath string) bool {
+	conn, err := net.DialTimeout("unix", controlPath, time.Second)
+	if err != nil {
+		return false
+	}
+
+	conn.Close() // nolint: errcheck
+	return true
+}
+
+// ListMasters get the ControlMaster sockets in the runtime directory having a master running,
+// the sockets left behind by the masters no longer running are removed
+func ListMasters(dir string) ([]Master, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+controlSocketExt))
+	if err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrInvalidArgs, err, "unable to list the ControlMaster sockets")
+	}
+	sort.Strings(paths)
+
+	masters := make([]Master, 0, len(paths))
+	for _, path := range paths {
+		master, ok := parseMaster(path)
+		if !ok {
+			continue
+		}
+
+		if !MasterRunning(path) {
+			os.Remove(path) // nolint: errcheck
+			continue
+		}
+
+		masters = append(masters, master)
+	}
+
+	return masters, nil
+}
+
+// Close asks the ControlMaster to exit, closing the multiplexed connections as well
+func (m Master) Close(ctx context.Context) error {
+	out, err := exec.CommandContext(ctx, "ssh", "-o", "ControlPath="+escapeTokens(m.Path), "-O", "exit", m.InstanceID).CombinedOutput()
+	if err != nil {
+		return errdefs.Wrap(errdefs.ErrSSHFailure, err, "unable to close the ControlMaster of '%s@%s': %s", m.User, m.InstanceID, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// parseMaster get the ControlMaster of the socket from its name
+func parseMaster(path string) (Master, bool) {
+	name := strings.TrimSuffix(filepath.Base(path), controlSocketExt)
+
+	user, rest, ok := strings.Cut(name, "@")
+	if !ok {
+		return Master{}, false
+	}
+
+	i := strings.LastIndex(rest, ":")
+	if i < 0 || user == "" || rest[:i] == "" {
+		return Master{}, false
+	}
+
+	return Master{
+		Path:       path,
+		InstanceID: rest[:i],
+		User:       user,
+		Port:       rest[i+1:],
+	}, true
+}
+
+// escapeTokens escapes the '%' of a path from the ssh token expansion
+func escapeTokens(path string) string {
+	return strings.ReplaceAll(path, "%", "%%")
+}
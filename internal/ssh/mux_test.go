@@ -0,0 +1,74 @@
+package ssh_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "awssh/internal/ssh"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxOptions(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "run")
+
+	controlPath, err := ControlPath(dir, "i-0387e016c47c6170c", "ec2-user", "22")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "ec2-user@i-0387e016c47c6170c:22.sock"), controlPath)
+
+	info, err := os.Stat(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	// an existing directory accessible by other users is made private
+	assert.Nil(t, os.Chmod(dir, 0755))
+	_, err = ControlPath(dir, "i-0387e016c47c6170c", "ec2-user", "22")
+	assert.Nil(t, err)
+	info, err = os.Stat(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	// a symlink is refused, as its target may be shared
+	link := filepath.Join(t.TempDir(), "run")
+	assert.Nil(t, os.Symlink(dir, link))
+	_, err = ControlPath(link, "i-0387e016c47c6170c", "ec2-user", "22")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, []string{
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=/run/user/1000/100%%/ec2-user@i-0387e016c47c6170c:22.sock",
+		"-o", "ControlPersist=600s",
+	}, MuxOptions("/run/user/1000/100%/ec2-user@i-0387e016c47c6170c:22.sock", 10*time.Minute))
+
+	assert.Equal(t, "/run/user/1000/awssh/%r@i-0387e016c47c6170c:%p.sock", ControlPathPattern("/run/user/1000/awssh", "i-0387e016c47c6170c"))
+	assert.Equal(t, []string{
+		"-o", "ControlPath=/run/user/1000/100%%/ec2-user@i-0387e016c47c6170c:22.sock", "-O", "check", "10.10.5.102",
+	}, CheckArgs("/run/user/1000/100%/ec2-user@i-0387e016c47c6170c:22.sock", "10.10.5.102"))
+}
+
+func TestListMasters(t *testing.T) {
+	dir := t.TempDir()
+
+	running, err := ControlPath(dir, "i-0387e016c47c6170c", "ec2-user", "22")
+	assert.Nil(t, err)
+	listener, err := net.Listen("unix", running)
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	stale, err := ControlPath(dir, "i-0b22a22eec53b9321", "ubuntu", "2222")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(stale, nil, 0600))
+
+	assert.True(t, MasterRunning(running))
+	assert.False(t, MasterRunning(stale))
+
+	masters, err := ListMasters(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []Master{{Path: running, InstanceID: "i-0387e016c47c6170c", User: "ec2-user", Port: "22"}}, masters)
+
+	_, err = os.Stat(stale)
+	assert.True(t, os.IsNotExist(err))
+}
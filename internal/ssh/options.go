@@ -0,0 +1,151 @@
+package ssh
+
+import (
+	"strings"
+
+	"awssh/internal/errdefs"
+)
+
+const (
+	// flagsWithoutValue are the ssh(1) flags without a value
+	flagsWithoutValue = "46AaCfGgKkMNnqsTtVvXxYy"
+	// flagsWithValue are the ssh(1) flags requiring a value
+	flagsWithValue = "BbcDEeFIiJLlmOoPpQRSWw"
+)
+
+// Options parses the additional ssh options with the POSIX shell quoting rules,
+// followed by the '-o' options from the values of the repeatable option flag.
+// The options are validated against the ssh(1) flags
+func Options(opts string, optValues []string) ([]string, error) {
+	args, err := SplitArgs(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, value := range optValues {
+		args = append(args, "-o", value)
+	}
+
+	if err := ValidateOptions(args); err != nil {
+		return nil, err
+	}
+
+	return args, nil
+}
+
+// SplitArgs splits the string into arguments with the POSIX shell quoting rules,
+// i.e. the single quotes, double quotes and backslash escapes. There is no expansion of variables or globs
+func SplitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inWord  bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			inWord = true
+			i++
+			if i == len(s) {
+				return nil, errdefs.New(errdefs.ErrInvalidArgs, "invalid ssh options, trailing backslash in %q", s)
+			}
+			// a backslash-newline is a line continuation
+			if s[i] != '\n' {
+				current.WriteByte(s[i])
+			}
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errdefs.New(errdefs.ErrInvalidArgs, "invalid ssh options, unterminated single quote in %q", s)
+			}
+			current.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(s); i++ {
+				if s[i] == '"' {
+					closed = true
+					break
+				}
+				// within double quotes, the backslash only escapes the characters special to them
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				current.WriteByte(s[i])
+			}
+			if !closed {
+				return nil, errdefs.New(errdefs.ErrInvalidArgs, "invalid ssh options, unterminated double quote in %q", s)
+			}
+		default:
+			inWord = true
+			current.WriteByte(c)
+		}
+	}
+
+	if inWord {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// ValidateOptions validates the arguments are ssh(1) options, i.e. the known flags with their values.
+// The flags can be grouped like '-qt', and a value is either attached to the flag or the next argument
+func ValidateOptions(args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) < 2 || arg[0] != '-' {
+			return errdefs.New(errdefs.ErrInvalidArgs, "invalid ssh option '%s', the ssh options must be flags", arg)
+		}
+
+		for j := 1; j < len(arg); j++ {
+			flag := arg[j]
+
+			if strings.IndexByte(flagsWithoutValue, flag) >= 0 {
+				continue
+			}
+
+			if strings.IndexByte(flagsWithValue, flag) < 0 {
+				return errdefs.New(errdefs.ErrInvalidArgs, "unknown ssh option '-%c' in '%s'", flag, arg)
+			}
+
+			// the rest of the argument is the value, otherwise the value is the next argument
+			if j == len(arg)-1 {
+				if i == len(args)-1 {
+					return errdefs.New(errdefs.ErrInvalidArgs, "ssh option '-%c' requires a value", flag)
+				}
+				i++
+			}
+			break
+		}
+	}
+
+	return nil
+}
+
+// JoinArgs joins the arguments into a string with the POSIX shell quoting rules, the inverse of SplitArgs.
+// An argument is single-quoted unless it consists of the characters safe to the shell
+func JoinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./_-") != "" {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,87 @@
+package ssh_test
+
+import (
+	"errors"
+	"testing"
+
+	"awssh/internal/errdefs"
+	. "awssh/internal/ssh"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitArgs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{name: "empty", input: "  "},
+		{name: "multiple spaces", input: "-o  ConnectTimeout=5\t-q", expected: []string{"-o", "ConnectTimeout=5", "-q"}},
+		{name: "double quotes", input: `-o "ProxyCommand=nc %h %p"`, expected: []string{"-o", "ProxyCommand=nc %h %p"}},
+		{name: "single quotes", input: `-o 'ProxyCommand=ssh -W "%h:%p" bastion'`, expected: []string{"-o", `ProxyCommand=ssh -W "%h:%p" bastion`}},
+		{name: "escapes", input: `-o ProxyCommand=nc\ %h\ %p -o "SetEnv=GREETING=\"hi\" \n"`, expected: []string{"-o", "ProxyCommand=nc %h %p", "-o", `SetEnv=GREETING="hi" \n`}},
+		{name: "adjacent quotes", input: `-oUser='ec2'"-user"`, expected: []string{"-oUser=ec2-user"}},
+		{name: "empty quoted argument", input: `-o ''`, expected: []string{"-o", ""}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args, err := SplitArgs(tc.input)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, args)
+		})
+	}
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, input := range []string{`-o "ProxyCommand=nc`, `-o 'ProxyCommand=nc`, `-o \`} {
+			_, err := SplitArgs(input)
+			assert.True(t, errors.Is(err, errdefs.ErrInvalidArgs), input)
+		}
+	})
+}
+
+func TestValidateOptions(t *testing.T) {
+	valid := [][]string{
+		nil,
+		{"-o", "ConnectTimeout=5"},
+		{"-oConnectTimeout=5", "-q"},
+		{"-qtW", "%h:%p"},
+		{"-i", "~/.ssh/id_rsa", "-A", "-L", "8080:localhost:80"},
+	}
+	for _, args := range valid {
+		assert.Nil(t, ValidateOptions(args), args)
+	}
+
+	invalid := [][]string{
+		{"-o"},
+		{"-qi"},
+		{"-Z"},
+		{"ConnectTimeout=5"},
+		{"-"},
+		{"-q", "10.10.5.100"},
+	}
+	for _, args := range invalid {
+		assert.True(t, errors.Is(ValidateOptions(args), errdefs.ErrInvalidArgs), args)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	args, err := Options(`-o "ProxyCommand=nc %h %p"`, []string{"ServerAliveInterval=60", "SetEnv=A=b c"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-o", "ProxyCommand=nc %h %p", "-o", "ServerAliveInterval=60", "-o", "SetEnv=A=b c"}, args)
+
+	_, err = Options("-o ConnectTimeout=5 jenkins", nil)
+	assert.True(t, errors.Is(err, errdefs.ErrInvalidArgs))
+}
+
+func TestJoinArgs(t *testing.T) {
+	args := []string{"ssh", "-F", "/tmp/awssh wrap/ssh_config", "-o", "ProxyCommand=nc %h %p", "-o", "SetEnv=GREETING='hi'", ""}
+
+	joined := JoinArgs(args)
+	assert.Equal(t, `ssh -F '/tmp/awssh wrap/ssh_config' -o 'ProxyCommand=nc %h %p' -o 'SetEnv=GREETING='\''hi'\''' ''`, joined)
+
+	split, err := SplitArgs(joined)
+	assert.Nil(t, err)
+	assert.Equal(t, args, split)
+}
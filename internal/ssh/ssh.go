@@ -1,32 +1,66 @@
 package ssh
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	gossh "golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 
 	"awssh/config"
+	"awssh/internal/errdefs"
 	"awssh/internal/logging"
 )
 
+// tmpKeyComment is the comment prefix of the temporary ssh keypair added into ssh-agent, followed by the ssh username,
+// the instance-id, and the hostname and pid of the awssh process owning the keypair, as the ssh-agent may be forwarded or shared
+const tmpKeyComment = "awssh-temporary-ssh-keypair"
+
+// tmpKeyLifetimeMargin is added to the ssh ControlMaster persistence as the lifetime of the temporary ssh keypair in ssh-agent,
+// a backstop for the keypairs left behind by the awssh processes killed before closing their session
+const tmpKeyLifetimeMargin = time.Hour
+
 // Session represent an SSH data model consist of a SSH PublicKey
 type Session struct {
-	PublicKey string
+	PublicKey   string
+	Fingerprint string
+
+	agent  agent.ExtendedAgent
+	tmpKey gossh.PublicKey
 }
 
 // NewSession creates a new SSH session from instanceID
 // This method will determine to select whether need to create a new temporary ssh keypair
-// or used the first existing key given from ssh-agent
+// or used the first existing key given from ssh-agent, other than the temporary keypairs of awssh.
+// The temporary ssh keypair lives in ssh-agent until the session is closed, so it outlives
+// the ssh re-keying and the secondary channels of a long-lived session
 func NewSession(sshAgent agent.ExtendedAgent, instanceID string) (session *Session, err error) {
-	existKeys, err := sshAgent.List()
+	if err := RemoveStaleKeys(sshAgent); err != nil {
+		logging.Logger().Warnf("awssh: %v", err)
+	}
+
+	keys, err := sshAgent.List()
 	if err != nil {
 		return nil, err
 	}
 
-	var publicKey string
+	existKeys := make([]*agent.Key, 0, len(keys))
+	for _, key := range keys {
+		if !strings.HasPrefix(key.Comment, tmpKeyComment) {
+			existKeys = append(existKeys, key)
+		}
+	}
+
+	var (
+		publicKey, fingerprint string
+		tmpKey                 gossh.PublicKey
+	)
 
 	if len(existKeys) == 0 {
 		keypair, err := NewKeyPair(2048)
@@ -36,29 +70,123 @@ func NewSession(sshAgent agent.ExtendedAgent, instanceID string) (session *Sessi
 
 		tmpSSHKeyPair := agent.AddedKey{
 			PrivateKey:       keypair.PrivateKey,
-			Comment:          fmt.Sprintf("awssh-temporary-ssh-keypair:%s:%s", config.GetSSHUsername(), instanceID),
-			LifetimeSecs:     30,
+			Comment:          fmt.Sprintf("%s:%s:%s:%s:%d", tmpKeyComment, config.GetSSHUsername(), instanceID, hostname(), os.Getpid()),
+			LifetimeSecs:     uint32((config.GetControlPersist() + tmpKeyLifetimeMargin).Seconds()),
 			ConfirmBeforeUse: false,
 		}
 
 		err = sshAgent.Add(tmpSSHKeyPair)
 		if err != nil {
-			return nil, fmt.Errorf("awssh: unable to add ssh keypair to ssh agent: (%v)", err)
+			return nil, errdefs.Wrap(errdefs.ErrSSHFailure, err, "unable to add ssh keypair to ssh agent")
 		}
 
 		logging.Logger().Debugf("Create temporary ssh-rsa keypair (%s)", gossh.FingerprintSHA256(keypair.PublicKey))
 		publicKeySerialized := gossh.MarshalAuthorizedKey(keypair.PublicKey)
 		publicKey = string(publicKeySerialized)
+		fingerprint = gossh.FingerprintSHA256(keypair.PublicKey)
+		tmpKey = keypair.PublicKey
 	} else {
 		logging.Logger().Debugf("Use existing ssh-rsa keypair from ssh-agent (%s)", gossh.FingerprintSHA256(existKeys[0]))
 		publicKey = fmt.Sprint(existKeys[0])
+		fingerprint = gossh.FingerprintSHA256(existKeys[0])
 	}
 
 	return &Session{
-		PublicKey: publicKey,
+		PublicKey:   publicKey,
+		Fingerprint: fingerprint,
+		agent:       sshAgent,
+		tmpKey:      tmpKey,
 	}, nil
 }
 
+// Close removes the temporary ssh keypair of the session from ssh-agent, if any
+func (s *Session) Close() error {
+	if s.tmpKey == nil {
+		return nil
+	}
+
+	if err := s.agent.Remove(s.tmpKey); err != nil {
+		return errdefs.Wrap(errdefs.ErrSSHFailure, err, "unable to remove temporary ssh keypair from ssh agent")
+	}
+
+	logging.Logger().Debugf("Remove temporary ssh-rsa keypair (%s)", s.Fingerprint)
+	s.tmpKey = nil
+	return nil
+}
+
+// RemoveStaleKeys removes the temporary ssh keypairs left in ssh-agent by the awssh processes of this host no longer running,
+// e.g. killed before closing their session. The keypairs of the running awssh processes and of the other hosts are kept,
+// the latter expire with their lifetime
+func RemoveStaleKeys(sshAgent agent.ExtendedAgent) error {
+	keys, err := sshAgent.List()
+	if err != nil {
+		return errdefs.Wrap(errdefs.ErrSSHFailure, err, "unable to list the ssh-agent keys")
+	}
+
+	localHost := hostname()
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key.Comment, tmpKeyComment) {
+			continue
+		}
+
+		host, pid := keyOwner(key.Comment)
+		if host != localHost || processRunning(pid) {
+			continue
+		}
+
+		if err := sshAgent.Remove(key); err != nil {
+			return errdefs.Wrap(errdefs.ErrSSHFailure, err, "unable to remove stale temporary ssh keypair from ssh agent")
+		}
+
+		logging.Logger().Debugf("Remove stale temporary ssh-rsa keypair (%s)", gossh.FingerprintSHA256(key))
+	}
+
+	return nil
+}
+
+// keyOwner get the hostname and pid of the awssh process owning the temporary ssh keypair from its comment,
+// they are empty for the keypairs added without them
+func keyOwner(comment string) (string, int) {
+	parts := strings.Split(comment, ":")
+	if len(parts) < 5 {
+		return "", 0
+	}
+
+	pid, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return "", 0
+	}
+
+	return parts[len(parts)-2], pid
+}
+
+// hostname get the hostname owning the temporary ssh keypairs, without the colons separating the comment parts
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "localhost"
+	}
+
+	return strings.ReplaceAll(host, ":", "_")
+}
+
+// processRunning reports whether the process of the pid is running
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	// the signal 0 only checks the process existence, a permission error means it exists under another user
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
 // NewAgent will initiate connection to ssh socket to initiate
 // ssh agent connection
 func NewAgent() (agent.ExtendedAgent, error) {
@@ -66,7 +194,7 @@ func NewAgent() (agent.ExtendedAgent, error) {
 	conn, err := net.Dial("unix", sshSocket)
 
 	if err != nil {
-		return nil, fmt.Errorf("awssh: failed to establish a connection to SSH_AUTH_SOCK: (%v)", err)
+		return nil, errdefs.Wrap(errdefs.ErrSSHFailure, err, "failed to establish a connection to SSH_AUTH_SOCK")
 	}
 
 	return agent.NewClient(conn), nil
@@ -4,7 +4,9 @@ import (
 	"awssh/config"
 	"awssh/internal/logging"
 	. "awssh/internal/ssh"
+	"fmt"
 	"os"
+	"os/exec"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,7 +27,7 @@ func (m mockSSHAgent) Add(key agent.AddedKey) error {
 
 func TestMain(m *testing.M) {
 	config.Load()
-	logging.NewLogger(false)
+	logging.NewLogger(logging.Options{}) // nolint: errcheck
 	code := m.Run()
 	os.Exit(code)
 }
@@ -35,3 +37,60 @@ func TestNewSession(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, sess)
 }
+
+func addKey(t *testing.T, keyring agent.Agent, comment string) *KeyPair {
+	keypair, err := NewKeyPair(1024)
+	assert.Nil(t, err)
+	assert.Nil(t, keyring.Add(agent.AddedKey{PrivateKey: keypair.PrivateKey, Comment: comment}))
+	return keypair
+}
+
+func agentComments(t *testing.T, keyring agent.Agent) []string {
+	keys, err := keyring.List()
+	assert.Nil(t, err)
+
+	comments := make([]string, 0, len(keys))
+	for _, key := range keys {
+		comments = append(comments, key.Comment)
+	}
+	return comments
+}
+
+func TestRemoveStaleKeys(t *testing.T) {
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	assert.Nil(t, exited.Run())
+
+	host, err := os.Hostname()
+	assert.Nil(t, err)
+
+	running := fmt.Sprintf("awssh-temporary-ssh-keypair:ec2-user:i-0387e016c47c6170c:%s:%d", host, os.Getpid())
+	// the pid of another host sharing the ssh-agent can not be checked on this host
+	otherHost := fmt.Sprintf("awssh-temporary-ssh-keypair:ec2-user:i-0387e016c47c6170c:bastion-%s:%d", host, exited.Process.Pid)
+	withoutOwner := "awssh-temporary-ssh-keypair:ec2-user:i-0387e016c47c6170c"
+
+	keyring := agent.NewKeyring().(agent.ExtendedAgent)
+	addKey(t, keyring, "john@laptop")
+	addKey(t, keyring, running)
+	addKey(t, keyring, otherHost)
+	addKey(t, keyring, withoutOwner)
+	addKey(t, keyring, fmt.Sprintf("awssh-temporary-ssh-keypair:ec2-user:i-0387e016c47c6170c:%s:%d", host, exited.Process.Pid))
+
+	assert.Nil(t, RemoveStaleKeys(keyring))
+	assert.ElementsMatch(t, []string{"john@laptop", running, otherHost, withoutOwner}, agentComments(t, keyring))
+}
+
+func TestSessionTemporaryKey(t *testing.T) {
+	keyring := agent.NewKeyring().(agent.ExtendedAgent)
+	// the temporary keypair of another running session is not reused
+	host, err := os.Hostname()
+	assert.Nil(t, err)
+	addKey(t, keyring, fmt.Sprintf("awssh-temporary-ssh-keypair:ec2-user:i-0387e016c47c6170c:%s:%d", host, os.Getpid()))
+
+	sess, err := NewSession(keyring, "i-0b22a22eec53b9321")
+	assert.Nil(t, err)
+	assert.Len(t, agentComments(t, keyring), 2)
+	assert.Contains(t, agentComments(t, keyring), fmt.Sprintf("awssh-temporary-ssh-keypair:%s:i-0b22a22eec53b9321:%s:%d", config.GetSSHUsername(), host, os.Getpid()))
+
+	assert.Nil(t, sess.Close())
+	assert.Len(t, agentComments(t, keyring), 1)
+}
@@ -5,6 +5,7 @@ import (
 
 	"awssh/cmd"
 	"awssh/config"
+	"awssh/internal/errdefs"
 )
 
 func main() {
@@ -13,10 +14,34 @@ func main() {
 
 	rootCmd := cmd.MakeRoot()
 	versionCmd := cmd.MakeVersion()
+	replayCmd := cmd.MakeReplay()
+	loginCmd := cmd.MakeLogin()
+	whoamiCmd := cmd.MakeWhoami()
+	doctorCmd := cmd.MakeDoctor()
+	aliasCmd := cmd.MakeAlias()
+	completionCmd := cmd.MakeCompletion()
+	rdpCmd := cmd.MakeRDP()
+	consoleCmd := cmd.MakeConsole()
+	wrapCmd := cmd.MakeWrap()
+	inventoryCmd := cmd.MakeInventory()
+	sessionsCmd := cmd.MakeSessions()
+	proxyCmd := cmd.MakeProxy()
 
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(replayCmd)
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(whoamiCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(aliasCmd)
+	rootCmd.AddCommand(completionCmd)
+	rootCmd.AddCommand(rdpCmd)
+	rootCmd.AddCommand(consoleCmd)
+	rootCmd.AddCommand(wrapCmd)
+	rootCmd.AddCommand(inventoryCmd)
+	rootCmd.AddCommand(sessionsCmd)
+	rootCmd.AddCommand(proxyCmd)
 
 	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+		os.Exit(errdefs.ExitCode(err))
 	}
 }